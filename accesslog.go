@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+var (
+	OptAccessLog = false
+)
+
+// loggingResponseWriter records the status and size of a response
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (self *loggingResponseWriter) WriteHeader(status int) {
+	// informational responses are followed by the real one
+	if self.status == 0 && status >= 200 {
+		self.status = status
+	}
+
+	self.ResponseWriter.WriteHeader(status)
+}
+
+func (self *loggingResponseWriter) Write(data []byte) (int, error) {
+	if self.status == 0 {
+		self.status = http.StatusOK
+	}
+
+	n, err := self.ResponseWriter.Write(data)
+	self.bytes += int64(n)
+
+	return n, err
+}
+
+func (self *loggingResponseWriter) Flush() {
+	http.NewResponseController(self.ResponseWriter).Flush()
+}
+
+func (self *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(self.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the original ResponseWriter
+func (self *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// withAccessLog logs every request with its status, response size and
+// duration if -access-log is set
+func withAccessLog(handler http.Handler) http.Handler {
+	if !OptAccessLog {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingResponseWriter{ResponseWriter: w}
+
+		handler.ServeHTTP(lw, r)
+
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+
+		user, _, _ := r.BasicAuth()
+
+		slog.Info("WebDAV request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", lw.status,
+			"bytes", lw.bytes,
+			"duration", time.Since(start),
+			"remote", clientIP(r),
+			"user", user,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AccessTokenFile = "proton-webdav-bridge/access_tokens.json"
+
+	PermissionReadOnly  = "read-only"
+	PermissionReadWrite = "read-write"
+)
+
+var (
+	accessTokens = &AccessTokenStore{tokens: make(map[string]AccessToken)}
+
+	accessTokenNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+	ErrAccessTokenName       = errors.New("token names must be 1-64 letters, digits, '.', '_' or '-'")
+	ErrAccessTokenPermission = errors.New("permission must be read-only or read-write")
+	ErrAccessTokenExists     = errors.New("a token with this name already exists")
+	ErrAccessTokenNotFound   = errors.New("no token with this name exists")
+	ErrAccessTokenClientCert = errors.New("access tokens can't be used together with -tls-client-ca")
+)
+
+// AccessToken grants WebDAV access with a fixed permission level. Clients
+// authenticate with the token name as username and the secret as password.
+// Only the SHA-256 of the secret is stored, the secret is shown once.
+type AccessToken struct {
+	Name       string    `json:"name"`
+	Permission string    `json:"permission"`
+	Hash       string    `json:"hash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AccessTokenStore holds the scoped WebDAV access tokens
+type AccessTokenStore struct {
+	tokens map[string]AccessToken
+
+	// set once a token existed, so revoking the last one doesn't open
+	// the share to everyone until the bridge is restarted
+	required bool
+
+	mu sync.RWMutex
+}
+
+// initAccessTokens loads the access tokens created through the admin API
+func initAccessTokens() error {
+	file, err := dataFile(AccessTokenFile)
+	if err != nil {
+		return err
+	}
+
+	enc, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var tokens []AccessToken
+	err = json.Unmarshal(enc, &tokens)
+	if err != nil {
+		return err
+	}
+
+	accessTokens.mu.Lock()
+	defer accessTokens.mu.Unlock()
+
+	for _, token := range tokens {
+		accessTokens.tokens[token.Name] = token
+	}
+
+	if len(tokens) > 0 {
+		accessTokens.required = true
+		slog.Info("Loaded WebDAV access tokens", "count", len(tokens))
+	}
+
+	return nil
+}
+
+// save writes all tokens to disk, the caller must hold the lock
+func (self *AccessTokenStore) save() error {
+	file, err := dataFile(AccessTokenFile)
+	if err != nil {
+		return err
+	}
+
+	enc, err := json.Marshal(self.list())
+	if err != nil {
+		return err
+	}
+
+	return writeDataFile(file, enc)
+}
+
+// list returns the tokens sorted by name, the caller must hold the lock
+func (self *AccessTokenStore) list() []AccessToken {
+	tokens := make([]AccessToken, 0, len(self.tokens))
+	for _, token := range self.tokens {
+		tokens = append(tokens, token)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Name < tokens[j].Name
+	})
+
+	return tokens
+}
+
+// List returns all tokens, sorted by name
+func (self *AccessTokenStore) List() []AccessToken {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.list()
+}
+
+// Empty reports whether no tokens exist
+func (self *AccessTokenStore) Empty() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return len(self.tokens) == 0
+}
+
+// Required reports whether WebDAV clients must authenticate because of tokens
+func (self *AccessTokenStore) Required() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.required
+}
+
+// Create generates a new token and returns it together with its secret
+func (self *AccessTokenStore) Create(name, permission string) (AccessToken, string, error) {
+	if OptTLSClientCA != "" {
+		return AccessToken{}, "", ErrAccessTokenClientCert
+	}
+
+	if !accessTokenNamePattern.MatchString(name) {
+		return AccessToken{}, "", ErrAccessTokenName
+	}
+
+	if permission != PermissionReadOnly && permission != PermissionReadWrite {
+		return AccessToken{}, "", ErrAccessTokenPermission
+	}
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return AccessToken{}, "", err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(secret))
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if _, ok := self.tokens[name]; ok {
+		return AccessToken{}, "", ErrAccessTokenExists
+	}
+
+	token := AccessToken{
+		Name:       name,
+		Permission: permission,
+		Hash:       hex.EncodeToString(sum[:]),
+		CreatedAt:  time.Now().UTC(),
+	}
+	self.tokens[name] = token
+
+	err = self.save()
+	if err != nil {
+		delete(self.tokens, name)
+		return AccessToken{}, "", err
+	}
+
+	self.required = true
+
+	slog.Info("Created WebDAV access token", "name", name, "permission", permission)
+	return token, secret, nil
+}
+
+// Revoke deletes a token, clients using it are rejected immediately
+func (self *AccessTokenStore) Revoke(name string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	token, ok := self.tokens[name]
+	if !ok {
+		return ErrAccessTokenNotFound
+	}
+
+	delete(self.tokens, name)
+
+	err := self.save()
+	if err != nil {
+		self.tokens[name] = token
+		return err
+	}
+
+	slog.Info("Revoked WebDAV access token", "name", name)
+	return nil
+}
+
+// Check validates a token name and secret and returns the permission it grants
+func (self *AccessTokenStore) Check(name, secret string) (string, bool) {
+	self.mu.RLock()
+	token, ok := self.tokens[name]
+	self.mu.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+
+	want, err := hex.DecodeString(token.Hash)
+	if err != nil {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(sum[:], want) != 1 {
+		return "", false
+	}
+
+	return token.Permission, true
+}
+
+// accessTokenResponse describes a token without its hash
+type accessTokenResponse struct {
+	Name       string    `json:"name"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+	Secret     string    `json:"secret,omitempty"`
+}
+
+type accessTokenRequest struct {
+	Name       string `json:"name"`
+	Permission string `json:"permission"`
+}
+
+// handleAccessTokens lists the tokens on GET and creates one on POST
+func handleAccessTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		response := []accessTokenResponse{}
+		for _, token := range accessTokens.List() {
+			response = append(response, accessTokenResponse{
+				Name:       token.Name,
+				Permission: token.Permission,
+				CreatedAt:  token.CreatedAt,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodPost:
+		var req accessTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		token, secret, err := accessTokens.Create(req.Name, req.Permission)
+		switch {
+		case errors.Is(err, ErrAccessTokenName), errors.Is(err, ErrAccessTokenPermission):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrAccessTokenExists), errors.Is(err, ErrAccessTokenClientCert):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			slog.Error("Error creating access token", "error", err)
+			http.Error(w, "Error creating token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(accessTokenResponse{
+			Name:       token.Name,
+			Permission: token.Permission,
+			CreatedAt:  token.CreatedAt,
+			Secret:     secret,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAccessTokenRevoke deletes the token with the given name
+func handleAccessTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req accessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err := accessTokens.Revoke(req.Name)
+	if errors.Is(err, ErrAccessTokenNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Error revoking access token", "error", err)
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
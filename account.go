@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/webdav"
+)
+
+var (
+	OptAccounts = ""
+	OptAccount  = ""
+	accounts    = []*Account{newAccount("")}
+)
+
+var (
+	accountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// Account is a Proton account whose drive is served by the bridge. Without
+// any configured accounts, there is a single unnamed account served at the
+// root of the WebDAV server. Named accounts are served under /<name>/.
+type Account struct {
+	Name   string
+	Status *AuthStatus
+
+	// set while the account is connected to Proton Drive
+	session    *drive.Session
+	filesystem *ProtonFS
+	handler    http.Handler
+	cancel     context.CancelFunc
+
+	// WebDAV requests that are being served by the current connection.
+	// Every connection gets its own, since the requests of a previous one
+	// may still be running after disconnect gave up on them.
+	requests *sync.WaitGroup
+
+	// cancels a session that is still connecting
+	pending context.CancelFunc
+	mu      sync.Mutex
+
+	// serializes connecting to Proton Drive
+	connecting sync.Mutex
+}
+
+func newAccount(name string) *Account {
+	return &Account{
+		Name:   name,
+		Status: &AuthStatus{Account: name, State: StateConnecting},
+	}
+}
+
+// initAccounts creates the accounts configured with -accounts
+func initAccounts() error {
+	if OptAccounts == "" {
+		return nil
+	}
+
+	accounts = nil
+	seen := map[string]bool{}
+
+	for _, name := range strings.Split(OptAccounts, ",") {
+		name = strings.TrimSpace(name)
+
+		if !accountNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid account name %q: use lowercase letters, digits, - and _", name)
+		}
+
+		if seen[name] {
+			return fmt.Errorf("account %q is configured twice", name)
+		}
+
+		if "/"+name == OptReadOnlySubpath {
+			return fmt.Errorf("account %q has the same path as -listen-webdav-readonly-subpath", name)
+		}
+
+		seen[name] = true
+		accounts = append(accounts, newAccount(name))
+	}
+
+	return nil
+}
+
+// findAccount returns the account with the given name. An empty name
+// refers to the first account.
+func findAccount(name string) *Account {
+	if name == "" {
+		return accounts[0]
+	}
+
+	for _, account := range accounts {
+		if account.Name == name {
+			return account
+		}
+	}
+
+	return nil
+}
+
+// accountFromRequest returns the account selected by the "account" query
+// parameter, responding with 404 if it does not exist.
+func accountFromRequest(w http.ResponseWriter, r *http.Request) *Account {
+	account := findAccount(r.URL.Query().Get("account"))
+	if account == nil {
+		http.Error(w, "Unknown account", http.StatusNotFound)
+	}
+
+	return account
+}
+
+// TokenFile returns the data file the tokens of the account are stored in
+func (self *Account) TokenFile() string {
+	return self.DataFile(path.Base(TokenFile))
+}
+
+// DataFile returns the name of a data file that belongs to the account
+func (self *Account) DataFile(base string) string {
+	if self.Name == "" {
+		return path.Join(DataDirName, base)
+	}
+
+	return path.Join(DataDirName, "accounts", self.Name, base)
+}
+
+// EnvName returns the name of the environment variable holding the given
+// credential for this account, e.g. PROTON_USERNAME or PROTON_WORK_USERNAME.
+func (self *Account) EnvName(key string) string {
+	if self.Name == "" {
+		return "PROTON_" + key
+	}
+
+	name := strings.ToUpper(strings.ReplaceAll(self.Name, "-", "_"))
+	return "PROTON_" + name + "_" + key
+}
+
+// CacheName returns the name a cache of the given kind is registered under for this account
+func (self *Account) CacheName(kind string) string {
+	if self.Name == "" {
+		return kind
+	}
+
+	return kind + "/" + self.Name
+}
+
+// Prefix returns the URL path the account is served under
+func (self *Account) Prefix() string {
+	if self.Name == "" {
+		return OptWebDAVPrefix
+	}
+
+	return OptWebDAVPrefix + "/" + self.Name
+}
+
+// Log returns a logger that tags messages with the account name if there is one
+func (self *Account) Log() *slog.Logger {
+	if self.Name == "" {
+		return slog.Default()
+	}
+
+	return slog.With("account", self.Name)
+}
+
+// Handler returns the WebDAV handler of the account, or nil if it is not connected
+func (self *Account) Handler() http.Handler {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.handler
+}
+
+// connect starts serving the account with a new session
+func (self *Account) connect(session *drive.Session, filesystem *ProtonFS, handler http.Handler, cancel context.CancelFunc) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.session = session
+	self.filesystem = filesystem
+	self.handler = handler
+	self.cancel = cancel
+	self.requests = &sync.WaitGroup{}
+}
+
+// connectStarted remembers how to cancel a session that is connecting
+func (self *Account) connectStarted(cancel context.CancelFunc) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.pending = cancel
+}
+
+// connectDone forgets the session that was connecting
+func (self *Account) connectDone() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.pending = nil
+}
+
+// cancelConnect aborts connecting a session, e.g. while it waits for a retry
+func (self *Account) cancelConnect() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.pending != nil {
+		self.pending()
+		self.pending = nil
+	}
+}
+
+// acquireHandler returns the WebDAV handler of the account, or nil if it is
+// not connected. The request counts as in flight until the returned release
+// function is called, which the account waits for before its session is
+// canceled.
+func (self *Account) acquireHandler() (http.Handler, func()) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.handler == nil {
+		return nil, nil
+	}
+
+	self.requests.Add(1)
+	return self.handler, self.requests.Done
+}
+
+// disconnect stops serving the account and cancels its session. New requests
+// are refused right away, while requests in flight get until deadline to
+// finish before the session is canceled under them. It reports whether the
+// account was connected.
+func (self *Account) disconnect(deadline time.Time) bool {
+	self.mu.Lock()
+
+	if self.pending != nil {
+		self.pending()
+		self.pending = nil
+	}
+
+	if self.handler == nil {
+		self.mu.Unlock()
+		return false
+	}
+
+	cancel := self.cancel
+	requests := self.requests
+	self.session = nil
+	self.filesystem = nil
+	self.handler = nil
+	self.cancel = nil
+	self.requests = nil
+
+	caches.Unregister(self.CacheName("metadata"))
+	self.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		requests.Wait()
+		close(drained)
+	}()
+
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+
+	select {
+	case <-drained:
+	case <-timeout.C:
+		self.Log().Warn("Requests still running after the shutdown timeout, aborting them")
+	}
+
+	cancel()
+	return true
+}
+
+// Session returns the Proton Drive session of the account, or nil if it is not connected
+func (self *Account) Session() *drive.Session {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.session
+}
+
+// FileSystem returns the drive of the account, or nil if it is not connected
+func (self *Account) FileSystem() *ProtonFS {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.filesystem
+}
+
+// anyAccountConnected reports whether at least one account is being served
+func anyAccountConnected() bool {
+	for _, account := range accounts {
+		if account.Handler() != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newAccountRouter dispatches WebDAV requests to the handler of the account
+// they address. With named accounts, the root lists one folder per account.
+func newAccountRouter() http.Handler {
+	root := webdav.NewMemFS()
+	for _, account := range accounts {
+		if account.Name != "" {
+			root.Mkdir(context.Background(), "/"+account.Name, 0777)
+		}
+	}
+
+	rootHandler := &webdav.Handler{
+		Prefix:     OptWebDAVPrefix,
+		FileSystem: root,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	readOnlyRootHandler := &webdav.Handler{
+		Prefix:     OptWebDAVPrefix + OptReadOnlySubpath,
+		FileSystem: root,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		account := accounts[0]
+
+		if account.Name != "" {
+			p, listing := strings.TrimPrefix(r.URL.Path, OptWebDAVPrefix), rootHandler
+			if isReadOnlyPath(r.URL.Path) {
+				p, listing = strings.TrimPrefix(p, OptReadOnlySubpath), readOnlyRootHandler
+			}
+
+			name, _, _ := strings.Cut(strings.TrimPrefix(path.Clean("/"+p), "/"), "/")
+
+			if name == "" {
+				switch r.Method {
+				case "OPTIONS":
+					// the root only lists the accounts
+					setDAVHeaders(w, "OPTIONS, PROPFIND")
+				case "PROPFIND", "GET", "HEAD":
+					listing.ServeHTTP(w, r)
+				default:
+					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				}
+				return
+			}
+
+			account = findAccount(name)
+			if account == nil {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		handler, release := account.acquireHandler()
+		if handler == nil {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Account is not connected", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// startAccount resumes the session of an account from its stored tokens,
+// or logs in with environment variables if there are none
+func startAccount(account *Account) {
+	tokens, err := loadTokensWithRetry(account)
+
+	if err != nil || tokens.AccessToken == "" {
+		account.Status.mu.Lock()
+		account.Status.State = StateNeverLoggedIn
+		account.Status.LoggedIn = false
+		account.Status.NeedsLogin = true
+		account.Status.Error = "No valid tokens found"
+		account.Status.mu.Unlock()
+
+		account.Log().Warn("Failed to load tokens", "error", err)
+
+		// tokens obtained out-of-band replace the username and password
+		tokens, ok, err := envTokens(account)
+		if ok {
+			if err == nil {
+				account.Log().Info("Attempting login with tokens from environment variables")
+				err = loginWithTokens(account, tokens)
+			}
+
+			if err != nil {
+				account.Log().Error("Login with tokens failed", "error", err)
+			}
+
+			return
+		}
+
+		if !canAutoLogin(account) {
+			account.Log().Info("Use the web UI to login or set environment variables")
+			return
+		}
+
+		// Auto-login using environment variables
+		account.Log().Info("Attempting automatic login with environment variables")
+		if err := doLogin(account); err != nil {
+			account.Log().Error("Automatic login failed", "error", err)
+		}
+
+		return
+	}
+
+	// We have tokens, make sure they are still good before serving
+	resumeSession(account, tokens)
+}
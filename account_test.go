@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveTestAccount serves a single unnamed account through the account
+// router, with handler as its connected WebDAV handler
+func serveTestAccount(t *testing.T, handler http.Handler, timeout time.Duration) (*Account, *httptest.Server, context.Context) {
+	t.Helper()
+
+	saved, savedTimeout := accounts, OptShutdownTimeout
+	t.Cleanup(func() {
+		accounts, OptShutdownTimeout = saved, savedTimeout
+	})
+
+	account := newAccount("")
+	accounts = []*Account{account}
+	OptShutdownTimeout = timeout
+
+	ctx, cancel := context.WithCancel(context.Background())
+	account.connect(nil, nil, handler, cancel)
+
+	server := httptest.NewServer(newAccountRouter())
+	t.Cleanup(server.Close)
+
+	return account, server, ctx
+}
+
+func TestStopWebDAVServerWaitsForDownloads(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	canceledEarly := make(chan bool, 1)
+
+	var session context.Context
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first half,")
+		w.(http.Flusher).Flush()
+
+		close(started)
+		<-release
+
+		canceledEarly <- session.Err() != nil
+		io.WriteString(w, "second half")
+	})
+
+	account, server, ctx := serveTestAccount(t, handler, 10*time.Second)
+	session = ctx
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+
+	download := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(server.URL + "/file.txt")
+		if err != nil {
+			download <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		download <- result{resp.StatusCode, string(body), err}
+	}()
+
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		stopWebDAVServer(account)
+		close(stopped)
+	}()
+
+	// new requests are refused while the download drains
+	for waitingForHandler(account) {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, err := http.Get(server.URL + "/other.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("request during shutdown returned %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	select {
+	case <-stopped:
+		t.Fatal("stopWebDAVServer returned while a download was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	if <-canceledEarly {
+		t.Error("the session was canceled before the download finished")
+	}
+
+	got := <-download
+	if got.err != nil || got.status != http.StatusOK || got.body != "first half,second half" {
+		t.Fatalf("download returned %d %q (%v), want the complete file", got.status, got.body, got.err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopWebDAVServer didn't return after the download finished")
+	}
+
+	if ctx.Err() == nil {
+		t.Error("the session wasn't canceled after the requests drained")
+	}
+}
+
+func TestReconnectAfterDrainTimeout(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	stuck := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+
+	account, server, ctx := serveTestAccount(t, stuck, 20*time.Millisecond)
+	defer close(release)
+
+	go http.Get(server.URL + "/stuck.txt")
+	<-started
+
+	start := time.Now()
+	stopWebDAVServer(account)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stopWebDAVServer took %v with a timeout of %v", elapsed, OptShutdownTimeout)
+	}
+
+	if ctx.Err() == nil {
+		t.Fatal("the session wasn't canceled after the timeout")
+	}
+
+	// the stuck request still belongs to the old connection, serving and
+	// draining the new one must not wait for it
+	_, cancel := context.WithCancel(context.Background())
+	account.connect(nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}), cancel)
+
+	resp, err := http.Get(server.URL + "/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("request after reconnecting returned %d", resp.StatusCode)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		account.disconnect(time.Now().Add(10 * time.Second))
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("disconnecting the new connection waited for a request of the old one")
+	}
+}
+
+// waitingForHandler reports whether the account still serves new requests
+func waitingForHandler(account *Account) bool {
+	account.mu.Lock()
+	defer account.mu.Unlock()
+
+	return account.handler != nil
+}
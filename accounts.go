@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// accountResponse describes which Proton account a bridge account is logged into
+type accountResponse struct {
+	Account     string `json:"account"`
+	LoggedIn    bool   `json:"logged_in"`
+	Username    string `json:"username,omitempty"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func handleAccounts(w http.ResponseWriter, r *http.Request) {
+	response := []accountResponse{}
+
+	for _, account := range accounts {
+		info := accountResponse{Account: account.Name}
+
+		user, _, err := fetchUser(r.Context(), account)
+		if err != nil {
+			info.Error = err.Error()
+		} else {
+			info.LoggedIn = true
+			info.Username = user.Name
+			info.Email = user.Email
+			info.DisplayName = user.DisplayName
+		}
+
+		response = append(response, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/StollD/webdav"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	OptAccessRules = ""
+	accessRules    AccessRules
+)
+
+// Access levels of the paths in the drive
+const (
+	AccessReadWrite = "read-write"
+	AccessReadOnly  = "read-only"
+	AccessHidden    = "hidden"
+)
+
+// AccessRule gives the paths matching a glob pattern an access level. A rule
+// for a folder applies to everything inside of it.
+type AccessRule struct {
+	Path   string `yaml:"path"`
+	Access string `yaml:"access"`
+}
+
+// AccessRules restrict what WebDAV clients can see and change. The first
+// matching rule wins, paths without one are read-write.
+type AccessRules []AccessRule
+
+// initAccessRules loads the rules file given with -access-rules
+func initAccessRules() error {
+	accessRules = nil
+
+	if OptAccessRules == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(OptAccessRules)
+	if err != nil {
+		return fmt.Errorf("error reading -access-rules: %w", err)
+	}
+
+	var rules AccessRules
+
+	err = yaml.Unmarshal(data, &rules)
+	if err != nil {
+		return fmt.Errorf("%s: %w", OptAccessRules, err)
+	}
+
+	for i, rule := range rules {
+		switch rule.Access {
+		case AccessReadWrite, AccessReadOnly, AccessHidden:
+		default:
+			return fmt.Errorf("%s: invalid access %q for %s", OptAccessRules, rule.Access, rule.Path)
+		}
+
+		rules[i].Path = path.Clean("/" + rule.Path)
+
+		// path.Match only fails on malformed patterns
+		_, err := path.Match(rules[i].Path, "/")
+		if err != nil {
+			return fmt.Errorf("%s: invalid path %q: %w", OptAccessRules, rule.Path, err)
+		}
+
+		if isRoot(rules[i].Path) && rule.Access == AccessHidden {
+			return fmt.Errorf("%s: the root folder can't be hidden", OptAccessRules)
+		}
+	}
+
+	accessRules = rules
+	return nil
+}
+
+// matches reports whether pattern matches name or one of its parent folders
+func (self AccessRule) matches(name string) bool {
+	for {
+		if ok, _ := path.Match(self.Path, name); ok {
+			return true
+		}
+
+		if name == "/" {
+			return false
+		}
+
+		name = path.Dir(name)
+	}
+}
+
+// Access returns the access level of name, a path of the WebDAV share
+func (self AccessRules) Access(name string) string {
+	name = path.Clean("/" + name)
+
+	for _, rule := range self {
+		if rule.matches(name) {
+			return rule.Access
+		}
+	}
+
+	return AccessReadWrite
+}
+
+// Hidden reports whether name must not be visible to clients
+func (self AccessRules) Hidden(name string) bool {
+	return self.Access(name) == AccessHidden
+}
+
+// Writable reports whether name may be created or changed. Only the path
+// itself is checked, see Removable for folders.
+func (self AccessRules) Writable(name string) bool {
+	return self.Access(name) == AccessReadWrite
+}
+
+// Removable reports whether name can be deleted, moved away or replaced.
+// For a folder, this also needs every path inside of it to be writable.
+// Since the contents aren't listed, this is decided from the rules alone: a
+// rule that could match something below the folder blocks it.
+func (self AccessRules) Removable(name string, isDir bool) bool {
+	if !self.Writable(name) {
+		return false
+	}
+
+	if !isDir {
+		return true
+	}
+
+	name = path.Clean("/" + name)
+	depth := strings.Count(name, "/")
+	if name == "/" {
+		depth = 0
+	}
+
+	for _, rule := range self {
+		if rule.Access == AccessReadWrite {
+			continue
+		}
+
+		segments := strings.Split(rule.Path, "/")
+		if len(segments)-1 <= depth {
+			continue
+		}
+
+		if ok, _ := path.Match(strings.Join(segments[:depth+1], "/"), name); ok || depth == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filter drops the children of the folder name that are hidden
+func (self AccessRules) filter(name string, children []os.FileInfo) []os.FileInfo {
+	if len(self) == 0 {
+		return children
+	}
+
+	filtered := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		if !self.Hidden(path.Join(name, child.Name())) {
+			filtered = append(filtered, child)
+		}
+	}
+
+	return filtered
+}
+
+// withAccessRules answers requests for hidden paths with 404 and rejects
+// changes to read-only paths with 403 before they reach the handler. The
+// filesystem enforces the same rules for everything the handler does on
+// its own, like walking folders.
+func withAccessRules(fs webdav.FileSystem, prefix string, handler http.Handler) http.Handler {
+	if len(accessRules) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := stripPrefix(r.URL.Path, prefix)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if accessRules.Hidden(name) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		allowed := true
+
+		switch r.Method {
+		case "PUT", "MKCOL", "PROPPATCH":
+			allowed = accessRules.Writable(name)
+		case "DELETE":
+			allowed = removable(r, fs, name)
+		case "MOVE":
+			allowed = removable(r, fs, name) && destinationWritable(r, fs, prefix)
+		case "COPY":
+			allowed = destinationWritable(r, fs, prefix)
+		case "LOCK":
+			// locking a missing resource would create it
+			if !accessRules.Writable(name) {
+				_, err := fs.Stat(r.Context(), name)
+				allowed = !os.IsNotExist(err)
+			}
+		}
+
+		if !allowed {
+			http.Error(w, "This path is read-only", http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// removable reports whether the access rules allow removing name, which
+// depends on whether it is a folder
+func removable(r *http.Request, fs webdav.FileSystem, name string) bool {
+	info, err := fs.Stat(r.Context(), name)
+	return accessRules.Removable(name, err == nil && info.IsDir())
+}
+
+// destinationWritable reports whether the access rules allow writing to the
+// Destination of a COPY or MOVE. Invalid destinations are left for the
+// handler to reject.
+func destinationWritable(r *http.Request, fs webdav.FileSystem, prefix string) bool {
+	dst, status := parseCopyDestination(r)
+	if status != 0 {
+		return true
+	}
+
+	dst, ok := stripPrefix(dst, prefix)
+	if !ok {
+		return true
+	}
+
+	return removable(r, fs, dst)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// bootstrapAdminPassword sets the admin password from ADMIN_PASSWORD if
+// there is none yet, so automated deployments don't need the setup screen.
+// An existing password is only replaced together with ADMIN_PASSWORD_RESET.
+// ADMIN_PASSWORD is removed from the environment so child processes don't
+// see it.
+func bootstrapAdminPassword() error {
+	password, ok, err := lookupCredential("ADMIN_PASSWORD")
+	os.Unsetenv("ADMIN_PASSWORD")
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return nil
+	}
+
+	_, err = loadAdminPassword()
+	if err == nil {
+		slog.Warn("Ignoring ADMIN_PASSWORD because an admin password is already set, set ADMIN_PASSWORD_RESET=true as well to replace it")
+		return nil
+	}
+
+	if len(password) < 8 {
+		return fmt.Errorf("ADMIN_PASSWORD must be at least 8 characters")
+	}
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("error hashing ADMIN_PASSWORD: %w", err)
+	}
+
+	err = storeAdminPassword(AdminPasswordData{PasswordHash: passwordHash})
+	if err != nil {
+		return fmt.Errorf("error storing ADMIN_PASSWORD: %w", err)
+	}
+
+	slog.Info("Admin password was set from ADMIN_PASSWORD")
+	return nil
+}
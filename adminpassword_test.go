@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBootstrapAdminPasswordUnsetsEnv(t *testing.T) {
+	useDataDir(t, t.TempDir())
+	t.Setenv("ADMIN_PASSWORD", "correct horse")
+
+	err := bootstrapAdminPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := os.LookupEnv("ADMIN_PASSWORD"); ok {
+		t.Error("ADMIN_PASSWORD is still in the environment")
+	}
+
+	data, err := loadAdminPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !verifyPassword("correct horse", data.PasswordHash, data.Salt) {
+		t.Error("stored password doesn't match ADMIN_PASSWORD")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+var (
+	OptAdminPrefix = ""
+)
+
+// normalizePrefix turns a user supplied prefix into the form "/foo" (or "")
+func normalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+
+	return "/" + prefix
+}
+
+// withAdminPrefix strips the admin prefix from incoming requests. Requests
+// that already had the prefix removed by a reverse proxy are passed through.
+func withAdminPrefix(handler http.Handler) http.Handler {
+	if OptAdminPrefix == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == OptAdminPrefix {
+			http.Redirect(w, r, OptAdminPrefix+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		p := strings.TrimPrefix(r.URL.Path, OptAdminPrefix)
+		if len(p) == len(r.URL.Path) || !strings.HasPrefix(p, "/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = p
+		r2.URL.RawPath = ""
+
+		handler.ServeHTTP(w, r2)
+	})
+}
+
+// withBaseHref serves index.html with its base href pointing at the admin
+// prefix, so relative asset and API URLs resolve correctly.
+func withBaseHref(handler http.Handler, static fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		index, err := fs.ReadFile(static, "index.html")
+		if err != nil {
+			http.Error(w, "Error reading index.html", http.StatusInternalServerError)
+			return
+		}
+
+		index = bytes.Replace(index, []byte(`<base href="/" />`), []byte(`<base href="`+OptAdminPrefix+`/" />`), 1)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(index)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminPrefix(t *testing.T) {
+	useDataDir(t, t.TempDir())
+
+	savedAuth, savedPrefix := adminAuth, OptAdminPrefix
+	t.Cleanup(func() {
+		adminAuth, OptAdminPrefix = savedAuth, savedPrefix
+	})
+
+	OptAdminPrefix = "/admin-prefix"
+	adminAuth = &AdminAuth{}
+	initAdminAuth()
+
+	handler, err := newAdminHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := server.Client()
+	client.Jar = jar
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	request := func(method, target, body string) (int, string) {
+		t.Helper()
+
+		r, err := http.NewRequest(method, server.URL+target, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode == http.StatusMovedPermanently {
+			return resp.StatusCode, resp.Header.Get("Location")
+		}
+
+		return resp.StatusCode, string(data)
+	}
+
+	// the UI resolves its assets and API calls relative to the prefix
+	status, body := request(http.MethodGet, "/admin-prefix/", "")
+	if status != http.StatusOK || !strings.Contains(body, `<base href="/admin-prefix/" />`) {
+		t.Fatalf("GET /admin-prefix/ returned %d without the base href of the prefix", status)
+	}
+
+	status, location := request(http.MethodGet, "/admin-prefix", "")
+	if status != http.StatusMovedPermanently || location != "/admin-prefix/" {
+		t.Errorf("GET /admin-prefix returned %d to %q, want a redirect to /admin-prefix/", status, location)
+	}
+
+	status, body = request(http.MethodGet, "/admin-prefix/api/admin/status", "")
+	if status != http.StatusOK || !strings.Contains(body, `"initialized":false`) {
+		t.Fatalf("GET /admin-prefix/api/admin/status returned %d: %s", status, body)
+	}
+
+	// a reverse proxy may strip the prefix itself
+	status, _ = request(http.MethodGet, "/api/admin/status", "")
+	if status != http.StatusOK {
+		t.Errorf("GET /api/admin/status returned %d, want %d", status, http.StatusOK)
+	}
+
+	status, _ = request(http.MethodGet, "/admin-prefix/api/status", "")
+	if status != http.StatusUnauthorized {
+		t.Errorf("GET /admin-prefix/api/status before the setup returned %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	adminAuth.mu.Lock()
+	token := adminAuth.setupToken
+	adminAuth.mu.Unlock()
+
+	setup, _ := json.Marshal(adminSetupRequest{Password: "correct horse battery", SetupToken: token})
+	status, body = request(http.MethodPost, "/admin-prefix/api/admin/setup", string(setup))
+	if status != http.StatusOK {
+		t.Fatalf("POST /admin-prefix/api/admin/setup returned %d: %s", status, body)
+	}
+
+	// the session cookie is scoped to the prefix and works for the API
+	status, body = request(http.MethodGet, "/admin-prefix/api/status", "")
+	if status != http.StatusOK || !strings.Contains(body, `"logged_in"`) {
+		t.Fatalf("GET /admin-prefix/api/status with the session returned %d: %s", status, body)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	CookieSecureAuto = "auto"
+)
+
+var (
+	OptAdminSessionTTL         = 24 * time.Hour
+	OptAdminSessionMaxLifetime = 7 * 24 * time.Hour
+	OptAdminCookieSameSite     = "strict"
+	OptAdminCookieSecure       = CookieSecureAuto
+	OptAdminCookieDomain       = ""
+)
+
+var cookieSameSiteModes = map[string]http.SameSite{
+	"strict": http.SameSiteStrictMode,
+	"lax":    http.SameSiteLaxMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// cookieSecure reports whether the session cookie sent in response to r is
+// marked Secure. By default, it is whenever the admin interface was reached
+// over HTTPS.
+func cookieSecure(r *http.Request) bool {
+	if OptAdminCookieSecure == CookieSecureAuto {
+		return isHTTPS(r) || OptAdminCookieSameSite == "none"
+	}
+
+	secure, _ := strconv.ParseBool(OptAdminCookieSecure)
+	return secure
+}
+
+// adminSession is a logged in admin session. Every authenticated request
+// moves its expiry forward by the session TTL, but never past the maximum
+// lifetime counted from the login.
+type adminSession struct {
+	created time.Time
+	expires time.Time
+
+	// address of the client that logged in
+	ip string
+}
+
+// newAdminSession stores a new session for token and returns its expiry.
+// The caller must hold adminAuth.mu.
+func newAdminSession(token, ip string) time.Time {
+	now := time.Now()
+
+	session := &adminSession{created: now, ip: ip}
+	session.extend(now)
+
+	adminAuth.sessions[token] = session
+	return session.expires
+}
+
+// extend slides the expiry of the session forward from now
+func (self *adminSession) extend(now time.Time) {
+	self.expires = now.Add(OptAdminSessionTTL)
+
+	if OptAdminSessionMaxLifetime > 0 {
+		limit := self.created.Add(OptAdminSessionMaxLifetime)
+		if self.expires.After(limit) {
+			self.expires = limit
+		}
+	}
+}
+
+// sessionID identifies a session in the API without revealing its token
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// maskToken shortens a session token to a few characters for display
+func maskToken(token string) string {
+	if len(token) < 8 {
+		return "…"
+	}
+
+	return token[:4] + "…" + token[len(token)-4:]
+}
+
+type adminSessionResponse struct {
+	ID      string    `json:"id"`
+	Token   string    `json:"token"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	IP      string    `json:"ip,omitempty"`
+	Current bool      `json:"current"`
+}
+
+// handleAdminSessions lists the active admin sessions on GET, and revokes the
+// session given by the id query parameter on DELETE
+func handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	current := ""
+	if cookie, err := r.Cookie("admin_session"); err == nil {
+		current = cookie.Value
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now()
+		response := []adminSessionResponse{}
+
+		adminAuth.mu.Lock()
+		for token, session := range adminAuth.sessions {
+			if now.After(session.expires) {
+				delete(adminAuth.sessions, token)
+				continue
+			}
+
+			response = append(response, adminSessionResponse{
+				ID:      sessionID(token),
+				Token:   maskToken(token),
+				Created: session.created,
+				Expires: session.expires,
+				IP:      session.ip,
+				Current: token == current,
+			})
+		}
+		adminAuth.mu.Unlock()
+
+		sort.Slice(response, func(i, j int) bool {
+			return response[i].Created.Before(response[j].Created)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Missing session id", http.StatusBadRequest)
+			return
+		}
+
+		revoked := false
+
+		adminAuth.mu.Lock()
+		for token := range adminAuth.sessions {
+			if sessionID(token) == id {
+				delete(adminAuth.sessions, token)
+				revoked = true
+			}
+		}
+		adminAuth.mu.Unlock()
+
+		if !revoked {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/StollD/webdav"
+)
+
+var (
+	OptFilterAppleDouble = false
+)
+
+// isAppleMetadata reports whether name is a .DS_Store or AppleDouble (._*)
+// file that Finder creates next to the real files
+func isAppleMetadata(name string) bool {
+	base := path.Base(name)
+	return base == ".DS_Store" || strings.HasPrefix(base, "._")
+}
+
+// isFiltered reports whether name is hidden from clients by -filter-apple-double
+func isFiltered(name string) bool {
+	return OptFilterAppleDouble && isAppleMetadata(name)
+}
+
+var _ webdav.File = &DiscardNode{}
+
+// DiscardNode accepts an upload and throws it away, so Finder believes its
+// metadata files were written without them ever reaching the drive
+type DiscardNode struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func NewDiscardNode(name string) *DiscardNode {
+	return &DiscardNode{
+		name:    path.Base(name),
+		modTime: time.Now(),
+	}
+}
+
+func (self *DiscardNode) Close() error {
+	return nil
+}
+
+func (self *DiscardNode) Read(_ []byte) (int, error) {
+	return 0, webdav.ErrNotImplemented
+}
+
+func (self *DiscardNode) Seek(_ int64, _ int) (int64, error) {
+	return 0, webdav.ErrNotImplemented
+}
+
+func (self *DiscardNode) Readdir(_ int) ([]fs.FileInfo, error) {
+	return nil, webdav.ErrNotImplemented
+}
+
+func (self *DiscardNode) Stat() (fs.FileInfo, error) {
+	return &ProtonNodeInfo{
+		name:    self.name,
+		size:    self.size,
+		modTime: self.modTime,
+	}, nil
+}
+
+func (self *DiscardNode) Write(buffer []byte) (int, error) {
+	self.size += int64(len(buffer))
+	return len(buffer), nil
+}
+
+// filterChildren removes Apple metadata files from a directory listing
+func filterChildren(children []os.FileInfo) []os.FileInfo {
+	if !OptFilterAppleDouble {
+		return children
+	}
+
+	filtered := children[:0]
+	for _, child := range children {
+		if !isAppleMetadata(child.Name()) {
+			filtered = append(filtered, child)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	OptAuditLog        = ""
+	OptAuditLogMaxSize = int64(10)
+
+	auditLog *AuditLog
+)
+
+const (
+	// AuditWebDAVInterval is how often a successful WebDAV login of the same
+	// user from the same address is recorded, since clients authenticate
+	// every single request
+	AuditWebDAVInterval = time.Hour
+)
+
+// Events recorded in the audit log
+const (
+	AuditAdminSetup  = "admin_setup"
+	AuditAdminLogin  = "admin_login"
+	AuditProtonLogin = "proton_login"
+	AuditWebDAVLogin = "webdav_login"
+)
+
+// AuditEvent is a line of the audit log. Passwords are never part of it.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Remote  string    `json:"remote"`
+	Success bool      `json:"success"`
+	User    string    `json:"user,omitempty"`
+	Account string    `json:"account,omitempty"`
+	Method  string    `json:"method,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// AuditLog appends login attempts to a file as JSON lines. Once the file
+// exceeds the maximum size, it is moved to <file>.1, replacing the previous
+// one, and a new file is started.
+type AuditLog struct {
+	file    string
+	maxSize int64
+
+	out  *os.File
+	size int64
+
+	// when successful WebDAV logins were last recorded
+	webdavLogins map[string]time.Time
+
+	mu sync.Mutex
+}
+
+// initAuditLog opens the audit log if -audit-log is set
+func initAuditLog() error {
+	if OptAuditLog == "" {
+		return nil
+	}
+
+	if OptAuditLogMaxSize <= 0 {
+		return fmt.Errorf("-audit-log-max-size must be positive")
+	}
+
+	auditLog = &AuditLog{
+		file:         OptAuditLog,
+		maxSize:      OptAuditLogMaxSize * 1024 * 1024,
+		webdavLogins: map[string]time.Time{},
+	}
+
+	err := auditLog.open()
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (self *AuditLog) open() error {
+	out, err := os.OpenFile(self.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, dataFileMode)
+	if err != nil {
+		return err
+	}
+
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	self.out = out
+	self.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file aside and starts a new one
+func (self *AuditLog) rotate() error {
+	self.out.Close()
+	self.out = nil
+
+	err := os.Rename(self.file, self.file+".1")
+	if err != nil {
+		return err
+	}
+
+	return self.open()
+}
+
+func (self *AuditLog) write(event AuditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	line = append(line, '\n')
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.out == nil || self.size+int64(len(line)) > self.maxSize {
+		err := self.rotate()
+		if err != nil {
+			slog.Error("Error rotating audit log", "file", self.file, "error", err)
+		}
+	}
+
+	if self.out == nil {
+		return
+	}
+
+	n, err := self.out.Write(line)
+	self.size += int64(n)
+
+	if err != nil {
+		slog.Error("Error writing audit log", "file", self.file, "error", err)
+	}
+}
+
+// recordWebDAV reports whether a successful WebDAV login should be written
+func (self *AuditLog) recordWebDAV(user, remote string, now time.Time) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for key, last := range self.webdavLogins {
+		if now.Sub(last) >= AuditWebDAVInterval {
+			delete(self.webdavLogins, key)
+		}
+	}
+
+	key := user + "\x00" + remote
+	if _, ok := self.webdavLogins[key]; ok {
+		return false
+	}
+
+	self.webdavLogins[key] = now
+	return true
+}
+
+// audit records a login attempt from r in the audit log, if there is one
+func audit(r *http.Request, event AuditEvent) {
+	if auditLog == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	event.Remote = clientIP(r)
+
+	if event.Event == AuditWebDAVLogin && event.Success && !auditLog.recordWebDAV(event.User, event.Remote, event.Time) {
+		return
+	}
+
+	auditLog.write(event)
+}
+
+// auditProtonLogin records a login of account into Proton with credentials,
+// with the reason the admin UI was given if it failed
+func auditProtonLogin(r *http.Request, account *Account, user string, err error) {
+	event := AuditEvent{Event: AuditProtonLogin, Success: err == nil, User: user, Account: account.Name, Method: "password"}
+
+	if err != nil {
+		account.Status.mu.Lock()
+		event.Reason = account.Status.ErrorCode
+		account.Status.mu.Unlock()
+
+		if event.Reason == "" {
+			event.Reason = LoginErrorFailed
+		}
+	}
+
+	audit(r, event)
+}
+
+// auditTokenLogin records a login of account into Proton with tokens
+func auditTokenLogin(r *http.Request, account *Account, err error) {
+	event := AuditEvent{Event: AuditProtonLogin, Success: err == nil, Account: account.Name, Method: "tokens"}
+
+	if errors.Is(err, ErrTokensRejected) {
+		event.Reason = "tokens_rejected"
+	} else if err != nil {
+		event.Reason = LoginErrorFailed
+	}
+
+	audit(r, event)
+}
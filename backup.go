@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	OptBackupDir      = ""
+	OptBackupCommand  = ""
+	OptBackupInterval = 24 * time.Hour
+)
+
+// stateFiles returns the paths of the files needed to restore the bridge
+func stateFiles() []string {
+	var files []string
+
+	for _, name := range dataFileNames() {
+		file, err := dataFile(name)
+		if err != nil {
+			continue
+		}
+
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
+
+// backupStateFiles copies the state files to the backup directory and runs
+// the backup command. Files are copied as they are stored on disk, so
+// encrypted tokens stay encrypted.
+func backupStateFiles() error {
+	files := stateFiles()
+	if len(files) == 0 {
+		return nil
+	}
+
+	if OptBackupDir != "" {
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			// keep the layout of the data directory, so the token
+			// files of different accounts don't overwrite each other
+			name, err := filepath.Rel(dataDir(), file)
+			if err != nil {
+				name = filepath.Base(file)
+			}
+
+			dst := filepath.Join(OptBackupDir, name)
+
+			err = os.MkdirAll(filepath.Dir(dst), dataDirMode)
+			if err != nil {
+				return err
+			}
+
+			err = writeDataFile(dst, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if OptBackupCommand != "" {
+		cmd := exec.Command("sh", "-c", OptBackupCommand)
+		cmd.Env = append(os.Environ(), "PROTON_BACKUP_FILES="+strings.Join(files, " "))
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("backup command failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	return nil
+}
+
+// runBackups periodically backs up the state files
+func runBackups() {
+	if OptBackupDir == "" && OptBackupCommand == "" {
+		return
+	}
+
+	for {
+		err := backupStateFiles()
+		if err != nil {
+			slog.Error("Error backing up state files", "error", err)
+		} else {
+			slog.Info("State files backed up")
+		}
+
+		if OptBackupInterval <= 0 {
+			return
+		}
+
+		time.Sleep(OptBackupInterval)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	OptDownloadRateLimit = int64(0)
+	OptUploadRateLimit   = int64(0)
+
+	downloadLimiter *rate.Limiter
+	uploadLimiter   *rate.Limiter
+)
+
+// initBandwidthLimits creates the limiters shared by all WebDAV requests
+func initBandwidthLimits() {
+	downloadLimiter = newBandwidthLimiter(OptDownloadRateLimit)
+	uploadLimiter = newBandwidthLimiter(OptUploadRateLimit)
+}
+
+// newBandwidthLimiter returns a limiter for bytesPerSecond, or nil if it is 0
+func newBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+}
+
+// waitBandwidth blocks until n bytes may pass the limiter. Chunks larger
+// than the burst of the limiter are waited for piece by piece.
+func waitBandwidth(ctx context.Context, limiter *rate.Limiter, n int) error {
+	for n > 0 {
+		chunk := min(n, limiter.Burst())
+
+		err := limiter.WaitN(ctx, chunk)
+		if err != nil {
+			return err
+		}
+
+		n -= chunk
+	}
+
+	return nil
+}
+
+// limitedReader reads the body of an upload no faster than the upload limit
+type limitedReader struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func (self *limitedReader) Read(data []byte) (int, error) {
+	n, err := self.ReadCloser.Read(data)
+	if n > 0 {
+		waitErr := waitBandwidth(self.ctx, uploadLimiter, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// limitedResponseWriter sends a download no faster than the download limit
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (self *limitedResponseWriter) Write(data []byte) (int, error) {
+	err := waitBandwidth(self.ctx, downloadLimiter, len(data))
+	if err != nil {
+		return 0, err
+	}
+
+	return self.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the original ResponseWriter
+func (self *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// withBandwidthLimit throttles the file contents transferred by GET and PUT
+// requests. The limits are shared by all requests, so they cap the total
+// bandwidth of the WebDAV server.
+func withBandwidthLimit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && downloadLimiter != nil:
+			w = &limitedResponseWriter{ResponseWriter: w, ctx: r.Context()}
+		case r.Method == http.MethodPut && uploadLimiter != nil:
+			r.Body = &limitedReader{ReadCloser: r.Body, ctx: r.Context()}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// browseEntry is a file or folder in a listing of /api/browse
+type browseEntry struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// browseResponse lists the children of a folder in the drive
+type browseResponse struct {
+	Account string        `json:"account,omitempty"`
+	Path    string        `json:"path"`
+	Entries []browseEntry `json:"entries"`
+}
+
+// handleBrowse lists the immediate children of the folder given by the path
+// query parameter, as seen by WebDAV clients
+func handleBrowse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+
+	filesystem := account.FileSystem()
+	if filesystem == nil {
+		http.Error(w, "Account is not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Query().Get("path"))
+
+	// checked first, so a file isn't opened for download
+	info, err := filesystem.Stat(r.Context(), name)
+	if err != nil {
+		browseError(w, err)
+		return
+	}
+
+	if !info.IsDir() {
+		http.Error(w, "Not a folder", http.StatusBadRequest)
+		return
+	}
+
+	dir, err := filesystem.OpenFile(r.Context(), name, os.O_RDONLY, 0)
+	if err != nil {
+		browseError(w, err)
+		return
+	}
+	defer dir.Close()
+
+	children, err := dir.Readdir(-1)
+	if err != nil {
+		browseError(w, err)
+		return
+	}
+
+	response := browseResponse{Account: account.Name, Path: name, Entries: []browseEntry{}}
+	for _, child := range children {
+		entry := browseEntry{
+			Name:     child.Name(),
+			Type:     "file",
+			Size:     child.Size(),
+			Modified: child.ModTime(),
+		}
+
+		if child.IsDir() {
+			entry.Type = "folder"
+			entry.Size = 0
+		}
+
+		response.Entries = append(response.Entries, entry)
+	}
+
+	sort.Slice(response.Entries, func(i, j int) bool {
+		return response.Entries[i].Name < response.Entries[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// browseError responds with the status matching an error of the drive
+func browseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, os.ErrPermission):
+		http.Error(w, "Permission denied", http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+var (
+	caches = &CacheRegistry{}
+)
+
+// CacheStats describes the state of a single cache
+type CacheStats struct {
+	Name      string  `json:"name"`
+	Entries   int     `json:"entries"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	HitRate   float64 `json:"hit_rate"`
+	DiskBytes int64   `json:"disk_bytes"`
+}
+
+// Cache is implemented by the caches of the bridge so they can be inspected
+// and flushed through the admin interface. Implementations must be safe for
+// concurrent use.
+type Cache interface {
+	Stats() CacheStats
+	// Flush removes all entries at or below prefix and returns their number
+	Flush(prefix string) int
+}
+
+// CacheRegistry keeps track of all active caches
+type CacheRegistry struct {
+	caches map[string]Cache
+	mu     sync.Mutex
+}
+
+// Register adds (or replaces) a cache under the given name
+func (self *CacheRegistry) Register(name string, cache Cache) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.caches == nil {
+		self.caches = map[string]Cache{}
+	}
+
+	self.caches[name] = cache
+}
+
+// Unregister removes the cache with the given name
+func (self *CacheRegistry) Unregister(name string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delete(self.caches, name)
+}
+
+func (self *CacheRegistry) list() []Cache {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	list := make([]Cache, 0, len(self.caches))
+	for _, cache := range self.caches {
+		list = append(list, cache)
+	}
+
+	return list
+}
+
+// Stats returns the statistics of all registered caches
+func (self *CacheRegistry) Stats() []CacheStats {
+	stats := []CacheStats{}
+
+	for _, cache := range self.list() {
+		s := cache.Stats()
+		if s.Hits+s.Misses > 0 {
+			s.HitRate = float64(s.Hits) / float64(s.Hits+s.Misses)
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats
+}
+
+// Flush removes all entries at or below prefix from every registered cache
+func (self *CacheRegistry) Flush(prefix string) int {
+	flushed := 0
+
+	for _, cache := range self.list() {
+		flushed += cache.Flush(prefix)
+	}
+
+	return flushed
+}
+
+// Invalidate drops everything cached for name and its descendants
+func (self *CacheRegistry) Invalidate(name string) {
+	self.Flush(name)
+}
+
+// pathHasPrefix reports whether name is prefix or lies below it
+func pathHasPrefix(name, prefix string) bool {
+	prefix = path.Clean("/" + prefix)
+	name = path.Clean("/" + name)
+
+	if prefix == "/" || name == prefix {
+		return true
+	}
+
+	return strings.HasPrefix(name, prefix+"/")
+}
+
+// cacheFlushRequest represents a cache flush request
+type cacheFlushRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+func handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(caches.Stats())
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+func handleCacheFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// An empty body flushes everything
+	var req cacheFlushRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	flushed := caches.Flush(req.Prefix)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "flushed": flushed})
+}
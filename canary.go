@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCanaryTripped = errors.New("write protection active: suspicious activity detected")
+)
+
+var (
+	OptCanaryDeletes    = 0.0
+	OptCanaryOverwrites = 0.0
+	OptCanaryWindow     = 10 * time.Second
+	OptCanaryWebhook    = ""
+	canary              = &Canary{}
+)
+
+// CanaryStatus describes the state of the mass-modification detector
+type CanaryStatus struct {
+	Tripped   bool      `json:"tripped"`
+	TrippedAt time.Time `json:"tripped_at,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Canary watches the rate of destructive operations and switches the bridge
+// into a protective read-only state once a configured threshold is exceeded.
+type Canary struct {
+	deletes    []time.Time
+	overwrites []time.Time
+	status     CanaryStatus
+	mu         sync.Mutex
+}
+
+// Check returns an error if write protection has been tripped
+func (self *Canary) Check() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.status.Tripped {
+		return ErrCanaryTripped
+	}
+
+	return nil
+}
+
+// RecordDelete accounts for a delete of the given path
+func (self *Canary) RecordDelete(name string) error {
+	return self.record(&self.deletes, OptCanaryDeletes, "deletes", name)
+}
+
+// RecordOverwrite accounts for an overwrite of the given path
+func (self *Canary) RecordOverwrite(name string) error {
+	return self.record(&self.overwrites, OptCanaryOverwrites, "overwrites", name)
+}
+
+func (self *Canary) record(events *[]time.Time, rate float64, kind string, name string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.status.Tripped {
+		return ErrCanaryTripped
+	}
+
+	if rate <= 0 || OptCanaryWindow <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-OptCanaryWindow)
+
+	// drop events that fell out of the window
+	kept := (*events)[:0]
+	for _, t := range *events {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	*events = append(kept, now)
+
+	limit := rate * OptCanaryWindow.Seconds()
+	if float64(len(*events)) <= limit {
+		return nil
+	}
+
+	self.status = CanaryStatus{
+		Tripped:   true,
+		TrippedAt: now,
+		Reason: fmt.Sprintf("%d %s within %s (limit %.1f/s), last path %s",
+			len(*events), kind, OptCanaryWindow, rate, name),
+	}
+
+	self.deletes = nil
+	self.overwrites = nil
+
+	slog.Warn("Write protection tripped", "reason", self.status.Reason)
+	go notifyCanaryWebhook(self.status)
+
+	return ErrCanaryTripped
+}
+
+// Status returns a copy of the current detector state
+func (self *Canary) Status() CanaryStatus {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.status
+}
+
+// Reset lifts the write protection
+func (self *Canary) Reset() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.status = CanaryStatus{}
+	self.deletes = nil
+	self.overwrites = nil
+
+	slog.Info("Write protection has been reset")
+}
+
+// notifyCanaryWebhook posts the tripping event to the configured webhook
+func notifyCanaryWebhook(status CanaryStatus) {
+	if OptCanaryWebhook == "" {
+		return
+	}
+
+	postWebhook(OptCanaryWebhook, map[string]any{
+		"event":      "write_protection_tripped",
+		"tripped_at": status.TrippedAt,
+		"reason":     status.Reason,
+	})
+}
+
+func handleCanaryStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(canary.Status())
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+func handleCanaryReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	canary.Reset()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+)
+
+var (
+	OptCheckLogin = false
+)
+
+// doCheckLogin logs in with the credentials from the environment of the
+// account and stores the tokens, without starting any servers. It never
+// prompts, so it can be used in scripts. It returns the exit code.
+func doCheckLogin(account *Account) int {
+	if !canAutoLogin(account) {
+		fmt.Printf("Login failed: %s and %s must be set\n", account.EnvName("USERNAME"), account.EnvName("PASSWORD"))
+		return 1
+	}
+
+	var credentials [4]string
+	for i, name := range []string{"USERNAME", "PASSWORD", "MAILBOX_PASSWORD", "2FA"} {
+		value, err := envCredential(account.EnvName(name))
+		if err != nil {
+			fmt.Println("Login failed:", err)
+			return 1
+		}
+
+		credentials[i] = value
+	}
+
+	err := authenticate(account, credentials[0], credentials[1], credentials[2], credentials[3])
+	if err != nil {
+		fmt.Println("Login failed:", err)
+		return 1
+	}
+
+	fmt.Println("Credentials are valid, the tokens have been stored")
+	return 0
+}
+
+// envCredential returns an optional credential from the credential
+// providers, without prompting for it if it is missing
+func envCredential(name string) (string, error) {
+	if !hasCredential(name) {
+		return "", nil
+	}
+
+	return getCredential(name, "", "", false)
+}
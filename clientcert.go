@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	OptTLSClientCA     = ""
+	OptTLSClientAccess = ""
+	clientCertAccess   map[string]string
+)
+
+// initClientCerts parses -tls-client-access, a comma-separated list of
+// common names and the permission a certificate with that name gets, e.g.
+// "laptop=read-write,tv=read-only". A * entry applies to every other name.
+// Without the option, every certificate signed by -tls-client-ca may write.
+// Passwords and access tokens aren't checked with client certificates, so
+// -webdav-user can't be combined with -tls-client-ca.
+func initClientCerts() error {
+	clientCertAccess = nil
+
+	if OptTLSClientCA == "" {
+		if OptTLSClientAccess != "" {
+			return fmt.Errorf("-tls-client-access requires -tls-client-ca")
+		}
+
+		return nil
+	}
+
+	if OptTLSCert == "" {
+		return fmt.Errorf("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+
+	if OptWebDAVUser != "" {
+		return fmt.Errorf("-tls-client-ca can't be combined with -webdav-user and -webdav-pass")
+	}
+
+	if !accessTokens.Empty() {
+		slog.Warn("WebDAV access tokens are ignored because -tls-client-ca is set, clients authenticate with their certificate")
+	}
+
+	_, err := loadClientCA()
+	if err != nil {
+		return err
+	}
+
+	if OptTLSClientAccess == "" {
+		return nil
+	}
+
+	clientCertAccess = map[string]string{}
+	for _, entry := range strings.Split(OptTLSClientAccess, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, permission, ok := strings.Cut(entry, "=")
+		name, permission = strings.TrimSpace(name), strings.TrimSpace(permission)
+
+		if !ok || name == "" {
+			return fmt.Errorf("invalid entry in -tls-client-access: %q", entry)
+		}
+
+		if permission != PermissionReadOnly && permission != PermissionReadWrite {
+			return fmt.Errorf("invalid permission for %q in -tls-client-access: %q", name, permission)
+		}
+
+		clientCertAccess[name] = permission
+	}
+
+	return nil
+}
+
+// loadClientCA reads the certificates in -tls-client-ca
+func loadClientCA() (*x509.CertPool, error) {
+	data, err := os.ReadFile(OptTLSClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("error reading -tls-client-ca: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in -tls-client-ca")
+	}
+
+	return pool, nil
+}
+
+// configureClientCerts makes the WebDAV server require a client certificate
+// signed by -tls-client-ca. Connections without one fail the TLS handshake.
+func configureClientCerts(server *http.Server) error {
+	if OptTLSClientCA == "" {
+		return nil
+	}
+
+	pool, err := loadClientCA()
+	if err != nil {
+		return err
+	}
+
+	if server.TLSConfig == nil {
+		server.TLSConfig = &tls.Config{}
+	}
+
+	server.TLSConfig.ClientCAs = pool
+	server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
+
+// clientCertPermission returns the common name of the verified client
+// certificate of r and the permission it grants. The permission is empty
+// if the name isn't listed in -tls-client-access.
+func clientCertPermission(r *http.Request) (string, string) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", ""
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if clientCertAccess == nil {
+		return name, PermissionReadWrite
+	}
+
+	if permission, ok := clientCertAccess[name]; ok {
+		return name, permission
+	}
+
+	return name, clientCertAccess["*"]
+}
+
+// serveClientCert authenticates a WebDAV request by its client certificate
+// instead of a password
+func serveClientCert(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	name, permission := clientCertPermission(r)
+	if permission == "" {
+		audit(r, AuditEvent{Event: AuditWebDAVLogin, User: name, Method: "client_cert", Reason: "not_allowed"})
+		http.Error(w, "This client certificate is not allowed", http.StatusForbidden)
+		return
+	}
+
+	audit(r, AuditEvent{Event: AuditWebDAVLogin, Success: true, User: name, Method: "client_cert"})
+
+	if permission == PermissionReadOnly {
+		if isModifyingMethod(r.Method) {
+			http.Error(w, "This client certificate is read-only", http.StatusForbidden)
+			return
+		}
+
+		r = withReadOnlyToken(r)
+	}
+
+	handler.ServeHTTP(w, r)
+}
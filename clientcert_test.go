@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClientCertsRejectPasswordAuth(t *testing.T) {
+	savedCA, savedCert, savedUser := OptTLSClientCA, OptTLSCert, OptWebDAVUser
+	t.Cleanup(func() {
+		OptTLSClientCA, OptTLSCert, OptWebDAVUser = savedCA, savedCert, savedUser
+	})
+
+	OptTLSClientCA = "clients-ca.pem"
+	OptTLSCert = "cert.pem"
+	OptWebDAVUser = "user"
+
+	err := initClientCerts()
+	if err == nil {
+		t.Error("-tls-client-ca was accepted together with -webdav-user")
+	}
+
+	_, _, err = accessTokens.Create("laptop", PermissionReadOnly)
+	if !errors.Is(err, ErrAccessTokenClientCert) {
+		t.Errorf("creating an access token with -tls-client-ca: got %v, want %v", err, ErrAccessTokenClientCert)
+	}
+}
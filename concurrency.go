@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+var (
+	OptMaxConcurrentRequests = 0
+)
+
+const (
+	// ConcurrencyRetryAfter is the Retry-After in seconds sent with requests
+	// that are refused because too many are running
+	ConcurrencyRetryAfter = "1"
+)
+
+// withConcurrencyLimit refuses WebDAV requests with 503 while
+// -max-concurrent-requests of them are running, so a misbehaving client
+// can't exhaust the rate limits of the Proton API. Requests are never
+// queued: a slot is taken without waiting or not at all, and given back when
+// the request returns, so long downloads can't block anything but new
+// requests.
+func withConcurrencyLimit(handler http.Handler) http.Handler {
+	if OptMaxConcurrentRequests <= 0 {
+		return handler
+	}
+
+	slots := make(chan struct{}, OptMaxConcurrentRequests)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			slog.Debug("Too many concurrent requests", "method", r.Method, "path", r.URL.Path, "remote", clientIP(r))
+
+			w.Header().Set("Retry-After", ConcurrencyRetryAfter)
+			http.Error(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+		defer func() { <-slots }()
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/StollD/webdav"
+)
+
+var _ webdav.LockSystem = &conditionalLS{}
+
+// conditionalLS completes the evaluation of If headers. The lock system of
+// the WebDAV library only matches lock tokens and ignores ETag and Not
+// conditions, so a list like (["etag"]) always failed. These conditions are
+// checked against the current state of the resource here, and lists without
+// any lock token are confirmed like requests without an If header.
+type conditionalLS struct {
+	webdav.LockSystem
+	fs webdav.FileSystem
+}
+
+func newConditionalLS(fs webdav.FileSystem, ls webdav.LockSystem) *conditionalLS {
+	return &conditionalLS{
+		LockSystem: ls,
+		fs:         fs,
+	}
+}
+
+func (self *conditionalLS) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	var tokens []webdav.Condition
+
+	for _, c := range conditions {
+		if !c.Not && c.Token != "" {
+			tokens = append(tokens, c)
+			continue
+		}
+
+		if !self.matches(now, name0, c) {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+
+	if len(tokens) > 0 {
+		return self.LockSystem.Confirm(now, name0, name1, tokens...)
+	}
+
+	return self.lockTemporarily(now, name0, name1)
+}
+
+// matches evaluates an ETag condition or a negated lock token against name
+func (self *conditionalLS) matches(now time.Time, name string, c webdav.Condition) bool {
+	if c.Token != "" {
+		release, err := self.LockSystem.Confirm(now, name, "", webdav.Condition{Token: c.Token})
+		if err != nil {
+			return c.Not
+		}
+
+		release()
+		return !c.Not
+	}
+
+	if name == "" {
+		return c.Not
+	}
+
+	info, err := self.fs.Stat(context.Background(), name)
+	if err != nil {
+		return c.Not
+	}
+
+	return etagEqual(etagOf(context.Background(), info), c.ETag) != c.Not
+}
+
+// lockTemporarily makes sure no other client holds a lock on the resources,
+// the same way the handler does for requests without an If header
+func (self *conditionalLS) lockTemporarily(now time.Time, names ...string) (func(), error) {
+	var tokens []string
+
+	release := func() {
+		for _, token := range tokens {
+			self.LockSystem.Unlock(now, token)
+		}
+	}
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		token, err := self.LockSystem.Create(now, webdav.LockDetails{
+			Root:      name,
+			Duration:  -1,
+			ZeroDepth: true,
+		})
+		if err != nil {
+			release()
+			return nil, webdav.ErrConfirmationFailed
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return release, nil
+}
+
+// etagOf returns the ETag the WebDAV handler reports for info
+func etagOf(ctx context.Context, info os.FileInfo) string {
+	if etager, ok := info.(webdav.ETager); ok {
+		etag, err := etager.ETag(ctx)
+		if err == nil {
+			return etag
+		}
+	}
+
+	return fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// etagEqual compares two ETags, ignoring weakness and quoting
+func etagEqual(a, b string) bool {
+	normalize := func(etag string) string {
+		return strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+	}
+
+	return normalize(a) == normalize(b)
+}
+
+// withConditionalGet answers GET and HEAD requests with 304 Not Modified if
+// the file still has the ETag in If-None-Match, or wasn't modified since
+// If-Modified-Since. This only needs the metadata of the file, while the
+// WebDAV handler opens the file first and, with -sniff-content-type,
+// downloads its first block before net/http evaluates the conditions.
+func withConditionalGet(fs webdav.FileSystem, prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		ifModifiedSince := r.Header.Get("If-Modified-Since")
+		if ifNoneMatch == "" && ifModifiedSince == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		name, ok := stripPrefix(r.URL.Path, prefix)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		info, err := fs.Stat(r.Context(), name)
+		if err != nil || info.IsDir() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		etag := etagOf(r.Context(), info)
+		if !notModified(ifNoneMatch, ifModifiedSince, etag, info.ModTime()) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		if !info.ModTime().IsZero() {
+			w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		}
+
+		w.WriteHeader(http.StatusNotModified)
+	})
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since if there is no
+// If-None-Match, as described in RFC 9110
+func notModified(ifNoneMatch, ifModifiedSince, etag string, modTime time.Time) bool {
+	if ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || etagEqual(candidate, etag) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if modTime.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+
+	// Last-Modified only has a resolution of seconds
+	return !modTime.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	OptConfig = ""
+)
+
+// configCredentials are the Proton credentials of an account in the config file
+type configCredentials struct {
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	MailboxPassword string `yaml:"mailbox-password"`
+	TwoFA           string `yaml:"2fa"`
+}
+
+// configAccount is a named account in the config file
+type configAccount struct {
+	Name              string `yaml:"name"`
+	configCredentials `yaml:",inline"`
+}
+
+// loadConfig applies the settings of a YAML config file. Every setting is
+// named like the command line flag it corresponds to. The precedence is:
+//
+//  1. flags given on the command line
+//  2. the config file
+//  3. environment variables
+//  4. built-in defaults
+func loadConfig(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]yaml.Node
+
+	err = yaml.Unmarshal(data, &settings)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	// flags given on the command line take precedence
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for key, node := range settings {
+		value := node.Value
+
+		switch key {
+		case "config":
+			return fmt.Errorf("%s: config files can't include other config files", file)
+
+		case "credentials":
+			var creds configCredentials
+
+			err := node.Decode(&creds)
+			if err != nil {
+				return fmt.Errorf("%s: credentials: %w", file, err)
+			}
+
+			applyCredentials("", creds)
+			continue
+
+		case "accounts":
+			if node.Kind != yaml.SequenceNode {
+				break
+			}
+
+			var accounts []configAccount
+
+			err := node.Decode(&accounts)
+			if err != nil {
+				return fmt.Errorf("%s: accounts: %w", file, err)
+			}
+
+			var names []string
+			for _, account := range accounts {
+				names = append(names, account.Name)
+				applyCredentials(account.Name, account.configCredentials)
+			}
+
+			node.Kind = yaml.ScalarNode
+			value = strings.Join(names, ",")
+
+		case "listen":
+			if node.Kind != yaml.SequenceNode {
+				break
+			}
+
+			var addrs []string
+
+			err := node.Decode(&addrs)
+			if err != nil {
+				return fmt.Errorf("%s: listen: %w", file, err)
+			}
+
+			node.Kind = yaml.ScalarNode
+			value = strings.Join(addrs, ",")
+		}
+
+		f := flag.Lookup(key)
+		if f == nil {
+			return fmt.Errorf("%s: unknown setting %q", file, key)
+		}
+
+		if node.Kind != yaml.ScalarNode {
+			return fmt.Errorf("%s: %s must be a single value", file, key)
+		}
+
+		if explicit[key] {
+			continue
+		}
+
+		err := f.Value.Set(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %w", file, key, err)
+		}
+	}
+
+	return nil
+}
+
+// applyCredentials makes the credentials of an account from the config file
+// available under the names of its environment variables, overriding them
+func applyCredentials(name string, creds configCredentials) {
+	account := &Account{Name: name}
+
+	values := map[string]string{
+		"USERNAME":         creds.Username,
+		"PASSWORD":         creds.Password,
+		"MAILBOX_PASSWORD": creds.MailboxPassword,
+		"2FA":              creds.TwoFA,
+	}
+
+	for key, value := range values {
+		if value != "" {
+			configSecrets[account.EnvName(key)] = value
+		}
+	}
+}
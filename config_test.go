@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigCredentialsStayOutOfEnvironment(t *testing.T) {
+	t.Cleanup(func() {
+		for name := range configSecrets {
+			delete(configSecrets, name)
+		}
+	})
+
+	t.Setenv("PROTON_PASSWORD", "from the environment")
+	os.Unsetenv("PROTON_PASSWORD")
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte("credentials:\n  username: me@proton.me\n  password: hunter2\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = loadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := os.LookupEnv("PROTON_PASSWORD"); ok {
+		t.Error("the password from the config file was put into the environment")
+	}
+
+	password, ok, err := lookupCredential("PROTON_PASSWORD")
+	if err != nil || !ok || password != "hunter2" {
+		t.Errorf("lookupCredential returned %q, %v, %v, want the password from the config file", password, ok, err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/henrybear327/go-proton-api"
+)
+
+var (
+	OptConnectRetries       = -1
+	OptConnectRetryMaxDelay = 5 * time.Minute
+)
+
+const (
+	ConnectRetryBaseDelay = 5 * time.Second
+)
+
+// initSession connects a new session to Proton Drive. Network errors and
+// temporary server errors are retried with exponential backoff, up to
+// OptConnectRetries times (forever if negative), until ctx is canceled.
+func initSession(ctx context.Context, account *Account, app *drive.Application) (*drive.Session, error) {
+	for attempt := 0; ; attempt++ {
+		session := drive.NewSession(app)
+
+		err := session.Init(ctx)
+		if err == nil {
+			if attempt > 0 {
+				account.Status.mu.Lock()
+				account.Status.Error = ""
+				account.Status.mu.Unlock()
+			}
+
+			return session, nil
+		}
+
+		if ctx.Err() != nil || !isTemporaryError(err) {
+			return nil, err
+		}
+
+		if OptConnectRetries >= 0 && attempt >= OptConnectRetries {
+			return nil, err
+		}
+
+		delay := connectRetryDelay(attempt)
+		account.Log().Warn("Error connecting to Proton Drive, retrying", "error", err, "attempt", attempt+1, "delay", delay)
+
+		account.Status.mu.Lock()
+		account.Status.Error = "Connection failed, retrying: " + err.Error()
+		account.Status.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isTemporaryError reports whether an error of the Proton API might go away
+// by trying again later
+func isTemporaryError(err error) bool {
+	var netErr *proton.NetError
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var apiErr *proton.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500
+	}
+
+	return false
+}
+
+// connectRetryDelay returns the delay before the given retry
+func connectRetryDelay(attempt int) time.Duration {
+	if attempt > 16 {
+		return OptConnectRetryMaxDelay
+	}
+
+	return min(ConnectRetryBaseDelay<<attempt, OptConnectRetryMaxDelay)
+}
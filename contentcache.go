@@ -0,0 +1,386 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/StollD/webdav"
+	"github.com/adrg/xdg"
+)
+
+const (
+	ContentCacheTempPrefix = "tmp-"
+)
+
+var (
+	OptContentCacheSize = int64(0)
+	OptContentCacheDir  = ""
+)
+
+// contentEntry is a file stored in the content cache
+type contentEntry struct {
+	key     string
+	name    string
+	size    int64
+	element *list.Element
+}
+
+// ContentCache keeps the contents of recently read files on disk, so files
+// that are read again and again aren't downloaded every time. Entries are
+// keyed by link and revision, so a changed file is never served from the
+// cache. Once the cache is full, the least recently used files are evicted.
+// A nil *ContentCache caches nothing.
+type ContentCache struct {
+	name  string
+	dir   string
+	limit int64
+	size  int64
+
+	entries map[string]*contentEntry
+	lru     *list.List
+
+	hits   uint64
+	misses uint64
+	mu     sync.Mutex
+}
+
+var _ Cache = &ContentCache{}
+
+// contentCacheDir returns the directory the content cache of an account is
+// stored in
+func contentCacheDir(account *Account) string {
+	dir := OptContentCacheDir
+	if dir == "" {
+		dir = filepath.Join(xdg.CacheHome, DataDirName, "content")
+	}
+
+	if account.Name == "" {
+		return dir
+	}
+
+	return filepath.Join(dir, "accounts", account.Name)
+}
+
+// NewContentCache creates a cache in dir that holds up to limit bytes and
+// picks up the files a previous run left there. It returns nil if limit is
+// not positive, which disables caching.
+func NewContentCache(name, dir string, limit int64) (*ContentCache, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &ContentCache{
+		name:    name,
+		dir:     dir,
+		limit:   limit,
+		entries: map[string]*contentEntry{},
+		lru:     list.New(),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type cachedFile struct {
+		key  string
+		size int64
+		used time.Time
+	}
+
+	var cached []cachedFile
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+
+		// leftovers of downloads that were interrupted
+		if strings.HasPrefix(file.Name(), ContentCacheTempPrefix) {
+			os.Remove(filepath.Join(dir, file.Name()))
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		cached = append(cached, cachedFile{key: file.Name(), size: info.Size(), used: info.ModTime()})
+	}
+
+	// the path of files from a previous run is unknown, they are only
+	// found through their revision
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].used.After(cached[j].used)
+	})
+
+	for _, file := range cached {
+		entry := &contentEntry{key: file.key, size: file.size}
+		entry.element = self.lru.PushBack(entry)
+
+		self.entries[file.key] = entry
+		self.size += file.size
+	}
+
+	self.evict()
+	return self, nil
+}
+
+// contentKey identifies the current revision of a file
+func contentKey(link *drive.Link) string {
+	if link.RevisionID() == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(link.ID() + "/" + link.RevisionID()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (self *ContentCache) file(key string) string {
+	return filepath.Join(self.dir, key)
+}
+
+// Open returns the cached contents of the current revision of link
+func (self *ContentCache) Open(name string, link *drive.Link) (*os.File, bool) {
+	if self == nil {
+		return nil, false
+	}
+
+	key := contentKey(link)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	entry, ok := self.entries[key]
+	if !ok {
+		self.misses++
+		return nil, false
+	}
+
+	file, err := os.Open(self.file(key))
+	if err != nil {
+		self.remove(entry)
+		self.misses++
+		return nil, false
+	}
+
+	self.hits++
+
+	entry.name = name
+	self.lru.MoveToFront(entry.element)
+
+	// keeps the order of use across restarts
+	now := time.Now()
+	os.Chtimes(self.file(key), now, now)
+
+	return file, true
+}
+
+// Fill starts storing the contents of link while they are downloaded. It
+// returns nil if the file can't be cached.
+func (self *ContentCache) Fill(name string, link *drive.Link) *contentFill {
+	if self == nil {
+		return nil
+	}
+
+	key := contentKey(link)
+	if key == "" || link.Size() > self.limit {
+		return nil
+	}
+
+	file, err := os.CreateTemp(self.dir, ContentCacheTempPrefix+"*")
+	if err != nil {
+		slog.Warn("Error creating content cache file", "error", err)
+		return nil
+	}
+
+	return &contentFill{cache: self, key: key, name: name, file: file}
+}
+
+// add moves a completely downloaded file into the cache
+func (self *ContentCache) add(fill *contentFill) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if _, ok := self.entries[fill.key]; ok {
+		os.Remove(fill.file.Name())
+		return
+	}
+
+	err := os.Rename(fill.file.Name(), self.file(fill.key))
+	if err != nil {
+		slog.Warn("Error storing file in content cache", "error", err)
+		os.Remove(fill.file.Name())
+		return
+	}
+
+	entry := &contentEntry{key: fill.key, name: fill.name, size: fill.written}
+	entry.element = self.lru.PushFront(entry)
+
+	self.entries[fill.key] = entry
+	self.size += fill.written
+
+	self.evict()
+}
+
+// evict removes the least recently used files until the cache fits its
+// limit, the caller must hold the lock
+func (self *ContentCache) evict() {
+	for self.size > self.limit {
+		element := self.lru.Back()
+		if element == nil {
+			return
+		}
+
+		self.remove(element.Value.(*contentEntry))
+	}
+}
+
+// remove deletes an entry, the caller must hold the lock
+func (self *ContentCache) remove(entry *contentEntry) {
+	os.Remove(self.file(entry.key))
+
+	self.lru.Remove(entry.element)
+	delete(self.entries, entry.key)
+	self.size -= entry.size
+}
+
+// Invalidate drops the cached contents of name and its descendants
+func (self *ContentCache) Invalidate(name string) {
+	if self == nil {
+		return
+	}
+
+	self.Flush(name)
+}
+
+func (self *ContentCache) Stats() CacheStats {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return CacheStats{
+		Name:      self.name,
+		Entries:   len(self.entries),
+		Hits:      self.hits,
+		Misses:    self.misses,
+		DiskBytes: self.size,
+	}
+}
+
+func (self *ContentCache) Flush(prefix string) int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	flushed := 0
+	for _, entry := range self.entries {
+		if pathHasPrefix(entry.name, prefix) {
+			self.remove(entry)
+			flushed++
+		}
+	}
+
+	return flushed
+}
+
+// contentFill writes a file to the content cache while it is downloaded.
+// Only a download that reads the whole file in order ends up in the cache.
+type contentFill struct {
+	cache   *ContentCache
+	key     string
+	name    string
+	file    *os.File
+	written int64
+}
+
+// Write stores the data read at offset, and gives up if it isn't the next
+// part of the file
+func (self *contentFill) Write(offset int64, data []byte) bool {
+	if offset != self.written {
+		return false
+	}
+
+	n, err := self.file.Write(data)
+	self.written += int64(n)
+
+	return err == nil
+}
+
+// Commit adds the file to the cache
+func (self *contentFill) Commit() {
+	err := self.file.Close()
+	if err != nil {
+		os.Remove(self.file.Name())
+		return
+	}
+
+	self.cache.add(self)
+}
+
+// Abort throws away what was stored so far
+func (self *contentFill) Abort() {
+	self.file.Close()
+	os.Remove(self.file.Name())
+}
+
+var _ webdav.File = &CachedReadNode{}
+var _ webdav.DeadPropsHolder = &CachedReadNode{}
+var _ io.Seeker = &CachedReadNode{}
+
+// CachedReadNode serves a file from the content cache
+type CachedReadNode struct {
+	file *os.File
+	info os.FileInfo
+}
+
+func NewCachedReadNode(file *os.File, info os.FileInfo) *CachedReadNode {
+	return &CachedReadNode{file: file, info: info}
+}
+
+func (self *CachedReadNode) Close() error {
+	return self.file.Close()
+}
+
+func (self *CachedReadNode) Read(buffer []byte) (int, error) {
+	return self.file.Read(buffer)
+}
+
+func (self *CachedReadNode) Seek(offset int64, whence int) (int64, error) {
+	return self.file.Seek(offset, whence)
+}
+
+func (self *CachedReadNode) Readdir(_ int) ([]fs.FileInfo, error) {
+	return nil, webdav.ErrNotImplemented
+}
+
+func (self *CachedReadNode) Stat() (fs.FileInfo, error) {
+	return self.info, nil
+}
+
+func (self *CachedReadNode) Write(_ []byte) (int, error) {
+	return 0, webdav.ErrNotImplemented
+}
+
+func (self *CachedReadNode) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return nodeProps(self.info), nil
+}
+
+func (self *CachedReadNode) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return forbidPatch(patches)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"path"
+)
+
+var (
+	OptSniffContentType = false
+)
+
+// sniffKey marks the context of requests whose response may sniff the
+// content type of a file
+type sniffKey struct{}
+
+// genericContentTypes are stored for files whose type wasn't known when
+// they were uploaded, so they say nothing about the contents
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"text/plain":               true,
+	"application/octet-stream": true,
+}
+
+// extraContentTypes fills the gaps in the types Go knows without a system
+// mime.types file, e.g. in the Docker image
+var extraContentTypes = map[string]string{
+	".7z":   "application/x-7z-compressed",
+	".avi":  "video/x-msvideo",
+	".bmp":  "image/bmp",
+	".csv":  "text/csv; charset=utf-8",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".epub": "application/epub+zip",
+	".flac": "audio/flac",
+	".gz":   "application/gzip",
+	".heic": "image/heic",
+	".ico":  "image/vnd.microsoft.icon",
+	".m4a":  "audio/mp4",
+	".m4v":  "video/x-m4v",
+	".md":   "text/markdown; charset=utf-8",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ogg":  "audio/ogg",
+	".opus": "audio/opus",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".tar":  "application/x-tar",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".txt":  "text/plain; charset=utf-8",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".zip":  "application/zip",
+}
+
+// initContentTypes registers the extra content types the system doesn't
+// know. This also makes new uploads get the right type in Proton Drive.
+func initContentTypes() {
+	for ext, ctype := range extraContentTypes {
+		if mime.TypeByExtension(ext) == "" {
+			mime.AddExtensionType(ext, ctype)
+		}
+	}
+}
+
+// contentType determines the type of a file from the type stored in Proton
+// Drive and its extension. It returns "" if neither tells anything.
+func contentType(name, stored string) string {
+	if !genericContentTypes[stored] {
+		return stored
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype != "" {
+		return ctype
+	}
+
+	return ""
+}
+
+// sniffAllowed reports whether the contents of a file may be read to
+// determine its type. Sniffing downloads the first block of the file, so it
+// is only done when the file is downloaded anyway.
+func sniffAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(sniffKey{}).(bool)
+	return OptSniffContentType && allowed
+}
+
+// withContentSniffing allows sniffing the content type for GET requests
+func withContentSniffing(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !OptSniffContentType || r.Method != http.MethodGet {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), sniffKey{}, true)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
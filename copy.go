@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/StollD/webdav"
+)
+
+// copyEntry is a single resource of a recursive copy
+type copyEntry struct {
+	src   string
+	dst   string
+	depth int
+	info  os.FileInfo
+}
+
+// copyFailure records a resource that could not be copied
+type copyFailure struct {
+	name   string
+	status int
+}
+
+// withParallelCopy handles recursive COPY requests of collections itself,
+// copying the files of the tree with a pool of workers. Everything else is
+// passed on to the WebDAV handler, which serves fs under prefix.
+//
+// Proton Drive can't copy files on the server, so every copied file is
+// downloaded and uploaded again by the bridge.
+func withParallelCopy(fs webdav.FileSystem, ls webdav.LockSystem, prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "COPY" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		// the handler treats every value but F as T
+		overwrite := r.Header.Get("Overwrite")
+		if overwrite != "" && overwrite != "T" && overwrite != "F" {
+			http.Error(w, "Invalid Overwrite header", http.StatusBadRequest)
+			return
+		}
+
+		src, ok := stripPrefix(r.URL.Path, prefix)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		dst, status := parseCopyDestination(r)
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		// copies between accounts are not supported
+		dst, ok = stripPrefix(dst, prefix)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+
+		// copying a collection into itself would never end, the handler
+		// doesn't guard against this
+		if dst == src || strings.HasPrefix(dst, strings.TrimSuffix(src, "/")+"/") {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		// requests with an If header need the handler's lock evaluation
+		if OptRecursiveWorkers <= 1 || r.Header.Get("If") != "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if depth := r.Header.Get("Depth"); depth != "" && !strings.EqualFold(depth, "infinity") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		info, err := fs.Stat(r.Context(), src)
+		if err != nil || !info.IsDir() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		status = copyTreeParallel(r.Context(), w, fs, ls, prefix, src, dst, info, overwrite != "F")
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+	})
+}
+
+// stripPrefix returns name relative to prefix, and whether it lies below it
+func stripPrefix(name, prefix string) (string, bool) {
+	name = path.Clean("/" + name)
+	if prefix == "" {
+		return name, true
+	}
+
+	if name != prefix && !strings.HasPrefix(name, prefix+"/") {
+		return "", false
+	}
+
+	return path.Clean("/" + strings.TrimPrefix(name, prefix)), true
+}
+
+// copyTreeParallel copies the collection src to dst. Collections are created
+// level by level, files are copied concurrently. It returns the status to
+// respond with, or 0 if a multistatus response has already been written.
+func copyTreeParallel(
+	ctx context.Context,
+	w http.ResponseWriter,
+	fs webdav.FileSystem,
+	ls webdav.LockSystem,
+	prefix string,
+	src, dst string,
+	info os.FileInfo,
+	overwrite bool,
+) int {
+	now := time.Now()
+
+	token, err := ls.Create(now, webdav.LockDetails{
+		Root:      dst,
+		Duration:  -1,
+		ZeroDepth: true,
+	})
+	if err == webdav.ErrLocked {
+		return webdav.StatusLocked
+	}
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	defer ls.Unlock(now, token)
+
+	created := true
+	if _, err := fs.Stat(ctx, dst); err == nil {
+		if !overwrite {
+			return http.StatusPreconditionFailed
+		}
+
+		err := fs.RemoveAll(ctx, dst)
+		if err != nil {
+			return http.StatusForbidden
+		}
+
+		created = false
+	}
+
+	dirs, files, err := collectCopyEntries(ctx, fs, src, dst, info)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+
+	var failures []copyFailure
+	failed := map[string]bool{}
+
+	// directories of the same depth are independent of each other
+	for start := 0; start < len(dirs); {
+		end := start
+		for end < len(dirs) && dirs[end].depth == dirs[start].depth {
+			end++
+		}
+
+		level := dirs[start:end]
+		errs := runParallel(ctx, OptRecursiveWorkers, len(level), func(ctx context.Context, i int) error {
+			if failed[path.Dir(level[i].dst)] {
+				return os.ErrNotExist
+			}
+
+			return fs.Mkdir(ctx, level[i].dst, 0777)
+		})
+
+		for i, err := range errs {
+			if err == nil {
+				continue
+			}
+
+			failed[level[i].dst] = true
+			failures = append(failures, copyFailure{name: level[i].src, status: copyErrorStatus(err)})
+		}
+
+		start = end
+	}
+
+	if failed[dst] {
+		return http.StatusConflict
+	}
+
+	errs := runParallel(ctx, OptRecursiveWorkers, len(files), func(ctx context.Context, i int) error {
+		if failed[path.Dir(files[i].dst)] {
+			return os.ErrNotExist
+		}
+
+		return copySingleFile(ctx, fs, files[i])
+	})
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		slog.Error("Error copying file", "path", files[i].src, "error", err)
+		failures = append(failures, copyFailure{name: files[i].src, status: copyErrorStatus(err)})
+	}
+
+	if len(failures) > 0 {
+		writeCopyMultistatus(w, prefix, failures)
+		return 0
+	}
+
+	if created {
+		return http.StatusCreated
+	}
+
+	return http.StatusNoContent
+}
+
+// collectCopyEntries walks the tree below src, returning its collections
+// (sorted by depth, starting with src itself) and its files.
+func collectCopyEntries(ctx context.Context, fs webdav.FileSystem, src, dst string, info os.FileInfo) ([]copyEntry, []copyEntry, error) {
+	dirs := []copyEntry{{src: src, dst: dst, depth: 0, info: info}}
+	files := []copyEntry{}
+
+	for i := 0; i < len(dirs); i++ {
+		dir := dirs[i]
+
+		f, err := fs.OpenFile(ctx, dir.src, os.O_RDONLY, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		children, err := f.Readdir(0)
+		f.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, child := range children {
+			entry := copyEntry{
+				src:   path.Join(dir.src, child.Name()),
+				dst:   path.Join(dir.dst, child.Name()),
+				depth: dir.depth + 1,
+				info:  child,
+			}
+
+			if child.IsDir() {
+				dirs = append(dirs, entry)
+			} else {
+				files = append(files, entry)
+			}
+		}
+	}
+
+	return dirs, files, nil
+}
+
+// copySingleFile streams one file from its source to its destination
+func copySingleFile(ctx context.Context, fs webdav.FileSystem, entry copyEntry) error {
+	in, err := fs.OpenFile(ctx, entry.src, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := fs.OpenFile(ctx, entry.dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if setter, ok := out.(webdav.ModTime); ok {
+		err := setter.SetModTime(ctx, entry.info.ModTime())
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// copyErrorStatus maps a copy error to a WebDAV status code
+func copyErrorStatus(err error) int {
+	switch {
+	case os.IsNotExist(err):
+		return http.StatusConflict
+	case os.IsPermission(err):
+		return http.StatusForbidden
+	case err == context.Canceled || err == context.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeCopyMultistatus reports the resources that failed to copy
+func writeCopyMultistatus(w http.ResponseWriter, prefix string, failures []copyFailure) {
+	type response struct {
+		Href   string `xml:"D:href"`
+		Status string `xml:"D:status"`
+	}
+
+	type multistatus struct {
+		XMLName   xml.Name   `xml:"D:multistatus"`
+		Namespace string     `xml:"xmlns:D,attr"`
+		Responses []response `xml:"D:response"`
+	}
+
+	ms := multistatus{Namespace: "DAV:"}
+	for _, failure := range failures {
+		ms.Responses = append(ms.Responses, response{
+			Href:   (&url.URL{Path: prefix + failure.name}).EscapedPath(),
+			Status: fmt.Sprintf("HTTP/1.1 %d %s", failure.status, http.StatusText(failure.status)),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(webdav.StatusMulti)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(ms)
+}
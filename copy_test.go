@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/StollD/webdav"
+)
+
+// concurrencyFS counts the files that are being written at the same time
+type concurrencyFS struct {
+	webdav.FileSystem
+
+	active  atomic.Int32
+	highest atomic.Int32
+}
+
+func (self *concurrencyFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	file, err := self.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil || flag == os.O_RDONLY {
+		return file, err
+	}
+
+	active := self.active.Add(1)
+	for {
+		highest := self.highest.Load()
+		if active <= highest || self.highest.CompareAndSwap(highest, active) {
+			break
+		}
+	}
+
+	// give the other workers a chance to overlap
+	time.Sleep(time.Millisecond)
+	return &countedFile{File: file, fs: self}, nil
+}
+
+type countedFile struct {
+	webdav.File
+	fs *concurrencyFS
+}
+
+func (self *countedFile) Close() error {
+	self.fs.active.Add(-1)
+	return self.File.Close()
+}
+
+func TestParallelCopy(t *testing.T) {
+	memfs := webdav.NewMemFS()
+	fs := &concurrencyFS{FileSystem: memfs}
+	ctx := context.Background()
+
+	// a tree of 3 levels with 8 folders and 10 files in each folder
+	var files []string
+	dirs := []string{"/src"}
+	for depth := 0; depth < 3; depth++ {
+		var next []string
+
+		for _, dir := range dirs {
+			err := memfs.Mkdir(ctx, dir, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 10; i++ {
+				name := fmt.Sprintf("%s/file%d.txt", dir, i)
+				writeMemFile(t, memfs, name, name)
+				files = append(files, name[len("/src"):])
+			}
+
+			if depth < 2 {
+				for i := 0; i < 8; i++ {
+					next = append(next, fmt.Sprintf("%s/dir%d", dir, i))
+				}
+			}
+		}
+
+		dirs = next
+	}
+
+	locks := webdav.NewMemLS()
+	handler := withParallelCopy(fs, locks, "", &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: locks,
+	})
+
+	// two copies at once share the workers
+	destinations := []string{"/copy1", "/copy2"}
+
+	var wg sync.WaitGroup
+	statuses := make([]int, len(destinations))
+	for i, dst := range destinations {
+		wg.Add(1)
+		go func(i int, dst string) {
+			defer wg.Done()
+
+			w := serveDAV(handler, "COPY", "/src", map[string]string{"Destination": dst, "Depth": "infinity"})
+			statuses[i] = w.Code
+		}(i, dst)
+	}
+	wg.Wait()
+
+	for i, dst := range destinations {
+		if statuses[i] != http.StatusCreated {
+			t.Fatalf("COPY to %s returned %d, want %d", dst, statuses[i], http.StatusCreated)
+		}
+
+		for _, name := range files {
+			content, ok := readMemFile(t, memfs, dst+name)
+			if !ok || content != "/src"+name {
+				t.Fatalf("%s%s contains %q (exists: %v), want %q", dst, name, content, ok, "/src"+name)
+			}
+		}
+	}
+
+	if highest := int(fs.highest.Load()); highest > OptRecursiveWorkers {
+		t.Errorf("%d files were copied at once, want at most %d across both requests", highest, OptRecursiveWorkers)
+	} else if highest < 2 {
+		t.Errorf("files were copied one at a time")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+var (
+	OptAdminCORSOrigin = ""
+)
+
+// withCORS allows the admin API to be used from the origin configured with
+// -admin-cors-origin. Credentials are only allowed for that origin, so the
+// session cookie is sent along. "*" allows any origin without credentials,
+// otherwise every website could act as the logged in admin.
+func withCORS(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if OptAdminCORSOrigin == "" || origin == "" || !strings.HasPrefix(r.URL.Path, OptAdminPrefix+"/api/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if OptAdminCORSOrigin != "*" && origin != OptAdminCORSOrigin {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		if OptAdminCORSOrigin == "*" {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+			header.Add("Vary", "Origin")
+		}
+
+		// answer preflight requests
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Content-Type")
+			header.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
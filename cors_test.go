@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCORSPreflightAllowsDelete(t *testing.T) {
+	saved := OptAdminCORSOrigin
+	t.Cleanup(func() { OptAdminCORSOrigin = saved })
+
+	OptAdminCORSOrigin = "https://admin.example.com"
+
+	handler := withCORS(http.NotFoundHandler())
+	rec := serveDAV(handler, http.MethodOptions, "/api/admin/sessions", map[string]string{
+		"Origin":                        "https://admin.example.com",
+		"Access-Control-Request-Method": http.MethodDelete,
+	})
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight: got %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	methods := rec.Header().Get("Access-Control-Allow-Methods")
+	if !strings.Contains(methods, http.MethodDelete) {
+		t.Errorf("Access-Control-Allow-Methods %q doesn't allow DELETE", methods)
+	}
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	saved := OptAdminCORSOrigin
+	t.Cleanup(func() { OptAdminCORSOrigin = saved })
+
+	handler := withCORS(http.NotFoundHandler())
+	headers := map[string]string{"Origin": "https://evil.example.com"}
+
+	OptAdminCORSOrigin = "*"
+	rec := serveDAV(handler, http.MethodGet, "/api/access-tokens", headers)
+
+	if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Errorf("wildcard: Access-Control-Allow-Origin is %q, want *", origin)
+	}
+
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("wildcard: credentials are allowed for any origin")
+	}
+
+	OptAdminCORSOrigin = "https://evil.example.com"
+	rec = serveDAV(handler, http.MethodGet, "/api/access-tokens", headers)
+
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("single origin: credentials aren't allowed")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CredentialProvider is a source of credentials. Credentials are named like
+// their environment variable, e.g. PROTON_PASSWORD.
+type CredentialProvider interface {
+	// Provides reports whether the provider has a value for the credential
+	Provides(name string) bool
+
+	// Lookup returns the value of the credential
+	Lookup(name string) (string, error)
+}
+
+// credentialProviders are asked for credentials in order, the first one
+// that provides a credential wins
+var credentialProviders = []CredentialProvider{
+	configSecrets,
+	envProvider{},
+	fileProvider{},
+	commandProvider{},
+}
+
+// configSecrets holds the credentials from the config file. They are kept in
+// memory instead of the environment, so child processes don't inherit them.
+var configSecrets = configProvider{}
+
+// configProvider reads credentials given in the config file
+type configProvider map[string]string
+
+func (self configProvider) Provides(name string) bool {
+	return self[name] != ""
+}
+
+func (self configProvider) Lookup(name string) (string, error) {
+	return self[name], nil
+}
+
+// envProvider reads credentials from environment variables
+type envProvider struct{}
+
+func (envProvider) Provides(name string) bool {
+	return os.Getenv(name) != ""
+}
+
+func (envProvider) Lookup(name string) (string, error) {
+	return os.Getenv(name), nil
+}
+
+// fileProvider reads credentials from the file named in <name>_FILE, e.g.
+// for Docker secrets
+type fileProvider struct{}
+
+func (fileProvider) Provides(name string) bool {
+	return os.Getenv(name+"_FILE") != ""
+}
+
+func (fileProvider) Lookup(name string) (string, error) {
+	data, err := os.ReadFile(os.Getenv(name + "_FILE"))
+	if err != nil {
+		return "", fmt.Errorf("error reading %s_FILE: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// commandProvider runs the shell command in <name>_COMMAND and reads the
+// credential from its output, e.g. to fetch it from a secret manager
+type commandProvider struct{}
+
+func (commandProvider) Provides(name string) bool {
+	return os.Getenv(name+"_COMMAND") != ""
+}
+
+func (commandProvider) Lookup(name string) (string, error) {
+	cmd := exec.Command("sh", "-c", os.Getenv(name+"_COMMAND"))
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running %s_COMMAND: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// initSecretOptions reads the WebDAV credentials from files or commands if
+// they weren't given as flags, in the config file or in the environment
+func initSecretOptions() error {
+	secrets := map[string]*string{
+		"PROTON_WEBDAV_USER": &OptWebDAVUser,
+		"PROTON_WEBDAV_PASS": &OptWebDAVPass,
+	}
+
+	for name, opt := range secrets {
+		if *opt != "" {
+			continue
+		}
+
+		value, _, err := lookupCredential(name)
+		if err != nil {
+			return err
+		}
+
+		*opt = value
+	}
+
+	return nil
+}
+
+// hasCredential reports whether any provider has a value for the credential
+func hasCredential(name string) bool {
+	for _, provider := range credentialProviders {
+		if provider.Provides(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupCredential returns the credential from the first provider that has
+// it. It reports false if none does.
+func lookupCredential(name string) (string, bool, error) {
+	for _, provider := range credentialProviders {
+		if !provider.Provides(name) {
+			continue
+		}
+
+		value, err := provider.Lookup(name)
+		return value, true, err
+	}
+
+	return "", false, nil
+}
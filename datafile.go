@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/adrg/xdg"
+)
+
+var (
+	OptDataDir      = ""
+	OptDataBackups  = 1
+	OptDataFileMode = "0600"
+	OptDataDirMode  = "0700"
+
+	dataFileMode os.FileMode = 0600
+	dataDirMode  os.FileMode = 0700
+)
+
+const (
+	DataDirName = "proton-webdav-bridge"
+)
+
+// parseFileMode parses an octal permission string like 0640
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, expected octal permissions like 0640", value)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// dataDir returns the directory the data files are stored in
+func dataDir() string {
+	if OptDataDir != "" {
+		return OptDataDir
+	}
+
+	return filepath.Join(xdg.DataHome, DataDirName)
+}
+
+// dataFile returns the path of a data file, creating its parent directories.
+// Names are relative to the XDG data directory, e.g. proton-webdav-bridge/tokens.json.
+func dataFile(name string) (string, error) {
+	if OptDataDir == "" {
+		return xdg.DataFile(name)
+	}
+
+	file := filepath.Join(OptDataDir, strings.TrimPrefix(name, DataDirName+"/"))
+
+	err := os.MkdirAll(filepath.Dir(file), dataDirMode)
+	if err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
+
+// initDataDir creates the data directory and makes sure it is writable
+func initDataDir() error {
+	var err error
+
+	dataFileMode, err = parseFileMode(OptDataFileMode)
+	if err != nil {
+		return fmt.Errorf("-data-file-mode: %w", err)
+	}
+
+	dataDirMode, err = parseFileMode(OptDataDirMode)
+	if err != nil {
+		return fmt.Errorf("-data-dir-mode: %w", err)
+	}
+
+	dir := dataDir()
+
+	err = os.MkdirAll(dir, dataDirMode)
+	if err != nil {
+		return fmt.Errorf("error creating data directory: %w", err)
+	}
+
+	// only touch existing directories if asked to, they may be shared
+	if dataDirMode != 0700 {
+		err = os.Chmod(dir, dataDirMode)
+		if err != nil {
+			return fmt.Errorf("error changing permissions of data directory: %w", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("data directory %s is not writable: %w", dir, err)
+	}
+
+	tmp.Close()
+	os.Remove(tmp.Name())
+
+	return nil
+}
+
+// backupName returns the path of the n-th backup of file, newest first
+func backupName(file string, n int) string {
+	if n == 0 {
+		return file + ".bak"
+	}
+
+	return fmt.Sprintf("%s.bak.%d", file, n)
+}
+
+// writeDataFile atomically replaces file with data, keeping the previous
+// contents as rotating backups.
+func writeDataFile(file string, data []byte) error {
+	return replaceFile(file, data, true)
+}
+
+// replaceFile atomically replaces file with data, optionally rotating the
+// backups of the previous contents
+func replaceFile(file string, data []byte, backup bool) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, dataDirMode); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	// only has an effect if the rename below did not happen
+	defer os.Remove(tmp.Name())
+
+	err = tmp.Chmod(dataFileMode)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	if backup {
+		err = rotateBackups(file)
+		if err != nil {
+			slog.Error("Error creating backup of data file", "file", file, "error", err)
+		}
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// rotateBackups shifts the existing backups of file by one and copies the
+// current contents of file into the newest slot.
+func rotateBackups(file string) error {
+	if OptDataBackups <= 0 {
+		return nil
+	}
+
+	current, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := OptDataBackups - 1; i > 0; i-- {
+		err := os.Rename(backupName(file, i-1), backupName(file, i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return replaceFile(backupName(file, 0), current, false)
+}
+
+// cleanupDataFile removes temp files left behind by interrupted writes of
+// file, as well as backups beyond the configured retention.
+func cleanupDataFile(file string) {
+	dir := filepath.Dir(file)
+	base := filepath.Base(file)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		stale := false
+
+		if strings.HasPrefix(name, base+".tmp-") {
+			stale = true
+		} else if name == base+".bak" {
+			stale = OptDataBackups < 1
+		} else if suffix, ok := strings.CutPrefix(name, base+".bak."); ok {
+			n, err := strconv.Atoi(suffix)
+			stale = err == nil && n >= OptDataBackups
+		}
+
+		if !stale {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(dir, name))
+		if err != nil {
+			slog.Error("Error removing data file", "file", name, "error", err)
+			continue
+		}
+
+		slog.Info("Removed stale data file", "file", name)
+	}
+}
+
+// dataFileNames returns the names of all data files of the bridge
+func dataFileNames() []string {
+	names := []string{AdminPasswordFile, AccessTokenFile}
+	for _, account := range accounts {
+		names = append(names, account.TokenFile())
+	}
+
+	return names
+}
+
+// cleanupDataFiles tidies up the data directory on startup
+func cleanupDataFiles() {
+	for _, name := range dataFileNames() {
+		file, err := dataFile(name)
+		if err != nil {
+			continue
+		}
+
+		cleanupDataFile(file)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// WebDAVMethods are all methods the WebDAV server supports
+const WebDAVMethods = "OPTIONS, GET, HEAD, POST, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND, PROPPATCH, LOCK, UNLOCK"
+
+// readOnlyTokenKey marks requests authenticated with a read-only access token
+type readOnlyTokenKey struct{}
+
+// isReadOnlyRequest reports whether r may not modify the drive
+func isReadOnlyRequest(r *http.Request) bool {
+	return OptReadOnly || r.Context().Value(readOnlyTokenKey{}) != nil || isReadOnlyPath(r.URL.Path)
+}
+
+// withReadOnlyToken marks r as authenticated with a read-only access token
+func withReadOnlyToken(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), readOnlyTokenKey{}, true))
+}
+
+// allowedMethods removes the methods r may not use from a list of methods
+func allowedMethods(r *http.Request, methods string) string {
+	if !isReadOnlyRequest(r) {
+		return methods
+	}
+
+	var allowed []string
+	for _, method := range strings.Split(methods, ",") {
+		method = strings.TrimSpace(method)
+		if !isModifyingMethod(method) {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return strings.Join(allowed, ", ")
+}
+
+// setDAVHeaders sets the headers of a response to OPTIONS
+func setDAVHeaders(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	w.Header().Set("DAV", "1, 2")
+	w.Header().Set("MS-Author-Via", "DAV")
+}
+
+// optionsResponseWriter filters the Allow header set by the WebDAV handler
+type optionsResponseWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	written bool
+}
+
+func (self *optionsResponseWriter) WriteHeader(status int) {
+	if !self.written {
+		self.written = true
+
+		allow := self.Header().Get("Allow")
+		if allow != "" {
+			self.Header().Set("Allow", allowedMethods(self.r, allow))
+		}
+	}
+
+	self.ResponseWriter.WriteHeader(status)
+}
+
+func (self *optionsResponseWriter) Write(data []byte) (int, error) {
+	if !self.written {
+		self.WriteHeader(http.StatusOK)
+	}
+
+	return self.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the original ResponseWriter
+func (self *optionsResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// withOptions answers OPTIONS * with the methods of the whole server, and
+// removes the methods a request may not use from the Allow header of
+// resources, e.g. in read-only mode. Clients like the Windows WebDAV
+// redirector decide what to offer based on these headers.
+func withOptions(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if r.URL.Path == "*" {
+			setDAVHeaders(w, allowedMethods(r, WebDAVMethods))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		ow := &optionsResponseWriter{ResponseWriter: w, r: r}
+		handler.ServeHTTP(ow, r)
+
+		// the WebDAV handler leaves writing the response to net/http
+		if !ow.written {
+			ow.WriteHeader(http.StatusOK)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// withDestination parses the Destination header of COPY and MOVE requests
+// once for everything behind it. Clients send a full URL or just a path,
+// percent-encoded or not always. The header is replaced by the encoded path,
+// so the host check of the WebDAV handler can't reject a destination that
+// names the bridge differently than the Host header, e.g. behind a proxy.
+func withDestination(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != "COPY" && r.Method != "MOVE") || r.Header.Get("Destination") == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		dst, status := parseCopyDestination(r)
+		if status != 0 {
+			http.Error(w, "Invalid Destination header", status)
+			return
+		}
+
+		r.Header.Set("Destination", (&url.URL{Path: dst}).EscapedPath())
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// parseCopyDestination extracts the decoded destination path of a COPY or
+// MOVE. Destinations on another server are answered with 502 as RFC 4918
+// asks, malformed ones with 400.
+func parseCopyDestination(r *http.Request) (string, int) {
+	hdr := r.Header.Get("Destination")
+	if hdr == "" {
+		return "", http.StatusBadRequest
+	}
+
+	// a bare path that doesn't parse, e.g. with an unencoded %, is taken
+	// as it is
+	if strings.HasPrefix(hdr, "/") && !strings.HasPrefix(hdr, "//") {
+		u, err := url.Parse(hdr)
+		if err != nil {
+			return path.Clean(hdr), 0
+		}
+
+		return path.Clean(u.Path), 0
+	}
+
+	u, err := url.Parse(hdr)
+	if err != nil || u.Host == "" {
+		return "", http.StatusBadRequest
+	}
+
+	if !isOwnHost(r, u) {
+		return "", http.StatusBadGateway
+	}
+
+	return path.Clean("/" + u.Path), 0
+}
+
+// isOwnHost reports whether u points to the server that received r, either
+// by the Host header or, behind a trusted proxy, by X-Forwarded-Host
+func isOwnHost(r *http.Request, u *url.URL) bool {
+	host := normalizeHost(u.Host, u.Scheme)
+
+	scheme := "http"
+	if isHTTPS(r) {
+		scheme = "https"
+	}
+
+	if host == normalizeHost(r.Host, scheme) {
+		return true
+	}
+
+	if !isTrustedProxy(remoteIP(r)) {
+		return false
+	}
+
+	for _, value := range r.Header.Values("X-Forwarded-Host") {
+		for _, forwarded := range strings.Split(value, ",") {
+			if host == normalizeHost(strings.TrimSpace(forwarded), scheme) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// normalizeHost lowercases host and drops the default port of scheme
+func normalizeHost(host, scheme string) string {
+	host = strings.ToLower(host)
+
+	switch scheme {
+	case "http":
+		return strings.TrimSuffix(host, ":80")
+	case "https":
+		return strings.TrimSuffix(host, ":443")
+	}
+
+	return host
+}
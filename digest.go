@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	ErrInvalidDigest = errors.New("invalid digest header")
+)
+
+// digestAlgorithms maps the (lowercase) algorithm names of the Digest header
+// to their hash implementations.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// parseUploadDigests collects the digests a client supplied through the
+// legacy Content-MD5 header and the RFC 3230 Digest header.
+func parseUploadDigests(header http.Header) (map[string][]byte, error) {
+	digests := map[string][]byte{}
+
+	if value := header.Get("Content-MD5"); value != "" {
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil || len(sum) != md5.Size {
+			return nil, ErrInvalidDigest
+		}
+
+		digests["md5"] = sum
+	}
+
+	for _, value := range header.Values("Digest") {
+		for _, part := range strings.Split(value, ",") {
+			algorithm, encoded, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				return nil, ErrInvalidDigest
+			}
+
+			algorithm = strings.ToLower(algorithm)
+			if _, ok := digestAlgorithms[algorithm]; !ok {
+				// unknown algorithms are ignored, as required by RFC 3230
+				continue
+			}
+
+			sum, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, ErrInvalidDigest
+			}
+
+			digests[algorithm] = sum
+		}
+	}
+
+	return digests, nil
+}
+
+// withUploadDigest verifies PUT bodies against the digests supplied by the
+// client. The body is spooled to a temporary file first, so that nothing is
+// uploaded to Proton Drive if it turns out to be corrupted.
+func withUploadDigest(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		digests, err := parseUploadDigests(r.Header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(digests) == 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		spool, err := os.CreateTemp("", "proton-webdav-upload-*")
+		if err != nil {
+			http.Error(w, "Error buffering upload", http.StatusInternalServerError)
+			return
+		}
+
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		hashes := map[string]hash.Hash{}
+		writers := []io.Writer{spool}
+
+		for algorithm := range digests {
+			hashes[algorithm] = digestAlgorithms[algorithm]()
+			writers = append(writers, hashes[algorithm])
+		}
+
+		_, err = io.Copy(io.MultiWriter(writers...), r.Body)
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			return
+		}
+
+		for algorithm, expected := range digests {
+			if bytes.Equal(hashes[algorithm].Sum(nil), expected) {
+				continue
+			}
+
+			slog.Warn("Rejected upload with mismatching digest", "path", r.URL.Path, "algorithm", algorithm, "remote", clientIP(r))
+			http.Error(w, fmt.Sprintf("%s digest mismatch", algorithm), http.StatusBadRequest)
+			return
+		}
+
+		_, err = spool.Seek(0, io.SeekStart)
+		if err != nil {
+			http.Error(w, "Error buffering upload", http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = spool
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StollD/webdav"
+)
+
+func TestWithUploadDigest(t *testing.T) {
+	const content = "The quick brown fox jumps over the lazy dog"
+
+	md5Sum := md5.Sum([]byte(content))
+	sha256Sum := sha256.Sum256([]byte(content))
+	sha512Sum := sha512.Sum512([]byte(content))
+	wrongSum := sha256.Sum256([]byte("something else"))
+
+	encode := base64.StdEncoding.EncodeToString
+	goodMD5 := encode(md5Sum[:])
+	goodSHA256 := encode(sha256Sum[:])
+	goodSHA512 := encode(sha512Sum[:])
+	wrongSHA256 := encode(wrongSum[:])
+	wrongMD5 := encode(wrongSum[:md5.Size])
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"no digest", nil, http.StatusCreated},
+		{"matching Content-MD5", map[string]string{"Content-MD5": goodMD5}, http.StatusCreated},
+		{"matching sha-256", map[string]string{"Digest": "SHA-256=" + goodSHA256}, http.StatusCreated},
+		{"matching sha-512 and md5", map[string]string{"Digest": "sha-512=" + goodSHA512 + ", md5=" + goodMD5}, http.StatusCreated},
+		{"unknown algorithm", map[string]string{"Digest": "unixsum=30637"}, http.StatusCreated},
+		{"mismatching Content-MD5", map[string]string{"Content-MD5": wrongMD5}, http.StatusBadRequest},
+		{"mismatching sha-256", map[string]string{"Digest": "sha-256=" + wrongSHA256}, http.StatusBadRequest},
+		{"one of several mismatching", map[string]string{"Content-MD5": goodMD5, "Digest": "sha-256=" + wrongSHA256}, http.StatusBadRequest},
+		{"malformed Digest", map[string]string{"Digest": "sha-256"}, http.StatusBadRequest},
+		{"malformed Content-MD5", map[string]string{"Content-MD5": "not base64!"}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := webdav.NewMemFS()
+			handler := withUploadDigest(&webdav.Handler{
+				FileSystem: fs,
+				LockSystem: webdav.NewMemLS(),
+			})
+
+			r := httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader(content))
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Fatalf("PUT returned %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+
+			stored, ok := readMemFile(t, fs, "/file.txt")
+			if test.status != http.StatusCreated {
+				if ok {
+					t.Fatal("a rejected upload was stored")
+				}
+
+				return
+			}
+
+			if stored != content {
+				t.Fatalf("stored %q, want %q", stored, content)
+			}
+		})
+	}
+}
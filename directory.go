@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/xml"
 	"io/fs"
 	"os"
 
@@ -9,10 +11,15 @@ import (
 )
 
 var _ webdav.File = &ProtonDirNode{}
+var _ webdav.DeadPropsHolder = &ProtonDirNode{}
 
 type ProtonDirNode struct {
 	info     os.FileInfo
 	children []os.FileInfo
+
+	// reports the quota of the drive, if set
+	fs  *ProtonFS
+	ctx context.Context
 }
 
 func NewDirNode(link *drive.Link) *ProtonDirNode {
@@ -24,10 +31,23 @@ func NewDirNode(link *drive.Link) *ProtonDirNode {
 
 	return &ProtonDirNode{
 		info:     NewNodeInfo(link),
-		children: children,
+		children: filterChildren(children),
 	}
 }
 
+// dirNode returns the node of a folder with the children the access rules
+// allow. It only reports the quota if the PROPFIND of ctx asks for it.
+func (self *ProtonFS) dirNode(ctx context.Context, name string, info os.FileInfo, children []os.FileInfo) *ProtonDirNode {
+	node := &ProtonDirNode{info: info, children: accessRules.filter(name, children)}
+
+	if quotaRequested(ctx, name) {
+		node.fs = self
+		node.ctx = ctx
+	}
+
+	return node
+}
+
 func (self *ProtonDirNode) Close() error {
 	return nil
 }
@@ -55,3 +75,19 @@ func (self *ProtonDirNode) Stat() (fs.FileInfo, error) {
 func (self *ProtonDirNode) Write(_ []byte) (int, error) {
 	return 0, webdav.ErrNotImplemented
 }
+
+func (self *ProtonDirNode) DeadProps() (map[xml.Name]webdav.Property, error) {
+	props := nodeProps(self.info)
+
+	if self.fs != nil {
+		for name, prop := range self.fs.quotaProps(self.ctx) {
+			props[name] = prop
+		}
+	}
+
+	return props, nil
+}
+
+func (self *ProtonDirNode) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return forbidPatch(patches)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	DownloadFailureAbort    = "abort"
+	DownloadFailureTruncate = "truncate"
+)
+
+var (
+	OptDownloadFailure = DownloadFailureAbort
+)
+
+type downloadFailureKey struct{}
+
+// downloadFailure is attached to every WebDAV request and set by the read
+// path when the upstream download breaks off in the middle of a response.
+type downloadFailure struct {
+	failed atomic.Bool
+}
+
+// reportDownloadFailure marks the request belonging to ctx as failed
+func reportDownloadFailure(ctx context.Context, name string, err error) {
+	slog.Error("Download failed mid-stream", "path", name, "error", err)
+
+	state, ok := ctx.Value(downloadFailureKey{}).(*downloadFailure)
+	if !ok {
+		return
+	}
+
+	state.failed.Store(true)
+}
+
+// withDownloadAbort resets the client connection if the upstream download
+// failed, so a truncated body is not mistaken for a complete file.
+func withDownloadAbort(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if OptDownloadFailure != DownloadFailureAbort {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		state := &downloadFailure{}
+		ctx := context.WithValue(r.Context(), downloadFailureKey{}, state)
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+
+		if state.failed.Load() {
+			// net/http recognizes this panic and aborts the connection
+			// without logging a stack trace
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingReader returns data and then fails like a broken upstream download
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (self *failingReader) Read(buffer []byte) (int, error) {
+	if len(self.data) == 0 {
+		return 0, self.err
+	}
+
+	n := copy(buffer, self.data)
+	self.data = self.data[n:]
+	return n, nil
+}
+
+func TestWithDownloadAbort(t *testing.T) {
+	upstreamErr := errors.New("block download failed")
+	data := bytes.Repeat([]byte("x"), 256*1024)
+
+	tests := []struct {
+		name          string
+		mode          string
+		contentLength bool
+		clientError   bool
+	}{
+		{"abort streamed", DownloadFailureAbort, false, true},
+		{"abort with Content-Length", DownloadFailureAbort, true, true},
+		{"truncate streamed", DownloadFailureTruncate, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved := OptDownloadFailure
+			OptDownloadFailure = test.mode
+			t.Cleanup(func() { OptDownloadFailure = saved })
+
+			// stands in for the WebDAV handler reading a ProtonReadNode
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentLength {
+					w.Header().Set("Content-Length", "1048576")
+				}
+
+				reader := &failingReader{data: data, err: upstreamErr}
+				_, err := io.Copy(w, reader)
+				if err != nil {
+					reportDownloadFailure(r.Context(), "/file.bin", err)
+				}
+			})
+
+			server := httptest.NewServer(withDownloadAbort(handler))
+			defer server.Close()
+
+			client := &http.Client{Timeout: 10 * time.Second}
+			resp, err := client.Get(server.URL + "/file.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET returned %d", resp.StatusCode)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+
+			if test.clientError && err == nil {
+				t.Fatalf("the client read a cleanly ended body of %d bytes after the upstream failure", len(body))
+			}
+
+			if !test.clientError && (err != nil || len(body) != len(data)) {
+				t.Fatalf("the client read %d bytes (%v), want the truncated %d bytes", len(body), err, len(data))
+			}
+		})
+	}
+}
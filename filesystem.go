@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"os"
 	"path"
+	"strings"
 
 	drive "github.com/StollD/proton-drive"
 	"github.com/StollD/webdav"
@@ -11,15 +14,81 @@ import (
 
 var _ webdav.FileSystem = &ProtonFS{}
 
+var (
+	ErrRootProtected = errors.New("the root folder cannot be deleted or moved")
+)
+
+// isRoot reports whether name refers to the root of the WebDAV share
+func isRoot(name string) bool {
+	return path.Clean("/"+name) == "/"
+}
+
+// withRootGuard rejects DELETE and MOVE of the root folder with 403, as a last
+// line of defense against a client wiping the whole drive. The root is the
+// drive of the account served under prefix.
+func withRootGuard(prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == "DELETE" || r.Method == "MOVE") && isRoot(strings.TrimPrefix(r.URL.Path, prefix)) {
+			http.Error(w, ErrRootProtected.Error(), http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
 type ProtonFS struct {
+	account *Account
 	session *drive.Session
+	root    string
+	cache   *MetadataCache
+	content *ContentCache
+}
+
+// newProtonFS creates the filesystem of an account and registers its cache
+func newProtonFS(account *Account, session *drive.Session) *ProtonFS {
+	filesystem := &ProtonFS{
+		account: account,
+		session: session,
+		root:    OptRootPath,
+		cache:   NewMetadataCache(account.CacheName("metadata"), OptCacheTTL),
+	}
+
+	if filesystem.cache != nil {
+		caches.Register(account.CacheName("metadata"), filesystem.cache)
+	}
+
+	content, err := NewContentCache(account.CacheName("content"), contentCacheDir(account), OptContentCacheSize<<20)
+	if err != nil {
+		account.Log().Error("Error opening content cache, file contents won't be cached", "error", err)
+	} else if content != nil {
+		filesystem.content = content
+		caches.Register(account.CacheName("content"), content)
+	}
+
+	return filesystem
+}
+
+// invalidate drops everything cached for name and its descendants
+func (self *ProtonFS) invalidate(name string) {
+	self.cache.Invalidate(name)
+	self.content.Invalidate(name)
 }
 
 func (self *ProtonFS) Mkdir(ctx context.Context, name string, _ os.FileMode) error {
+	if !accessRules.Writable(name) {
+		return os.ErrPermission
+	}
+
+	err := canary.Check()
+	if err != nil {
+		return err
+	}
+
 	links := self.session.Links()
 	filesystem := self.session.FileSystem()
 
-	name = path.Clean(name)
+	name = path.Clean(self.abs(name))
 	dir, file := path.Split(name)
 
 	link := links.LinkFromPath(name)
@@ -32,6 +101,7 @@ func (self *ProtonFS) Mkdir(ctx context.Context, name string, _ os.FileMode) err
 		return os.ErrNotExist
 	}
 
+	defer self.invalidate(name)
 	return filesystem.CreateDir(ctx, parent, file)
 }
 
@@ -45,17 +115,62 @@ func (self *ProtonFS) OpenFile(ctx context.Context, name string, flag int, _ os.
 		return nil, webdav.ErrNotImplemented
 	}
 
+	if isFiltered(name) {
+		if isRead {
+			return nil, os.ErrNotExist
+		}
+
+		return NewDiscardNode(name), nil
+	}
+
+	if accessRules.Hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	if isWrite && !accessRules.Writable(name) {
+		return nil, os.ErrPermission
+	}
+
+	share := name
+	name = self.abs(name)
+
 	link := links.LinkFromPath(name)
 	if link == nil && isRead {
 		return nil, os.ErrNotExist
 	}
 
 	if isRead {
+		if info, children, ok := self.cache.Readdir(name); ok {
+			return self.dirNode(ctx, share, info, children), nil
+		}
+
 		if link.IsDir() {
-			return NewDirNode(link), nil
+			node := NewDirNode(link)
+			self.cache.PutReaddir(name, node.info, node.children)
+			return self.dirNode(ctx, share, node.info, node.children), nil
 		}
 
-		return NewReadNode(ctx, self.session, link), nil
+		if file, ok := self.content.Open(name, link); ok {
+			return NewCachedReadNode(file, NewNodeInfo(link)), nil
+		}
+
+		node := NewReadNode(ctx, self.session, link)
+		node.cache = self.content
+		node.name = name
+
+		return node, nil
+	}
+
+	if link != nil {
+		err := canary.RecordOverwrite(name)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := canary.Check()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	name = path.Clean(name)
@@ -66,10 +181,34 @@ func (self *ProtonFS) OpenFile(ctx context.Context, name string, flag int, _ os.
 		return nil, os.ErrNotExist
 	}
 
-	return NewWriteNode(ctx, self.session, parent, file), nil
+	// the file changes once the upload completes
+	self.invalidate(name)
+
+	node := NewWriteNode(ctx, self.session, parent, file)
+	node.onClose = func() {
+		self.invalidate(name)
+	}
+
+	return node, nil
 }
 
 func (self *ProtonFS) RemoveAll(ctx context.Context, name string) error {
+	if isRoot(name) {
+		return ErrRootProtected
+	}
+
+	// there is nothing visible to delete
+	if isFiltered(name) {
+		return nil
+	}
+
+	if accessRules.Hidden(name) {
+		return os.ErrNotExist
+	}
+
+	share := name
+	name = self.abs(name)
+
 	links := self.session.Links()
 	filesystem := self.session.FileSystem()
 
@@ -78,10 +217,42 @@ func (self *ProtonFS) RemoveAll(ctx context.Context, name string) error {
 		return os.ErrNotExist
 	}
 
+	if !accessRules.Removable(share, link.IsDir()) {
+		return os.ErrPermission
+	}
+
+	err := canary.RecordDelete(name)
+	if err != nil {
+		return err
+	}
+
+	defer self.invalidate(name)
+
+	if OptTrashEnabled && !isTrashed(name) {
+		return self.moveToTrash(ctx, link, share)
+	}
+
 	return filesystem.Delete(ctx, link)
 }
 
 func (self *ProtonFS) Rename(ctx context.Context, oldName, newName string) error {
+	if isRoot(oldName) || isRoot(newName) {
+		return ErrRootProtected
+	}
+
+	if isFiltered(oldName) || accessRules.Hidden(oldName) {
+		return os.ErrNotExist
+	}
+
+	oldShare, newShare := oldName, newName
+	oldName = self.abs(oldName)
+	newName = self.abs(newName)
+
+	err := canary.Check()
+	if err != nil {
+		return err
+	}
+
 	links := self.session.Links()
 	filesystem := self.session.FileSystem()
 
@@ -93,15 +264,32 @@ func (self *ProtonFS) Rename(ctx context.Context, oldName, newName string) error
 		return os.ErrNotExist
 	}
 
+	if !accessRules.Removable(oldShare, link.IsDir()) || !accessRules.Writable(newShare) {
+		return os.ErrPermission
+	}
+
 	parent := links.LinkFromPath(dir)
 	if parent == nil {
 		return os.ErrNotExist
 	}
 
+	defer self.invalidate(newName)
+	defer self.invalidate(oldName)
+
 	return filesystem.Move(ctx, link, parent, file)
 }
 
 func (self *ProtonFS) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	if isFiltered(name) || accessRules.Hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	name = self.abs(name)
+
+	if info, ok := self.cache.Stat(name); ok {
+		return info, nil
+	}
+
 	links := self.session.Links()
 
 	link := links.LinkFromPath(name)
@@ -109,5 +297,8 @@ func (self *ProtonFS) Stat(_ context.Context, name string) (os.FileInfo, error)
 		return nil, os.ErrNotExist
 	}
 
-	return NewNodeInfo(link), nil
+	info := NewNodeInfo(link)
+	self.cache.PutStat(name, info)
+
+	return info, nil
 }
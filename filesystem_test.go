@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/StollD/webdav"
+)
+
+func TestRootGuard(t *testing.T) {
+	configs := []struct {
+		name     string
+		prefix   string
+		accounts []string
+	}{
+		{"single account", "", []string{""}},
+		{"webdav prefix", "/dav", []string{""}},
+		{"named accounts", "", []string{"alice", "bob"}},
+		{"named accounts under a prefix", "/dav", []string{"alice", "bob"}},
+	}
+
+	for _, config := range configs {
+		t.Run(config.name, func(t *testing.T) {
+			savedAccounts, savedPrefix := accounts, OptWebDAVPrefix
+			t.Cleanup(func() {
+				accounts, OptWebDAVPrefix = savedAccounts, savedPrefix
+			})
+
+			OptWebDAVPrefix = config.prefix
+			accounts = nil
+
+			filesystems := map[*Account]webdav.FileSystem{}
+			for _, name := range config.accounts {
+				account := newAccount(name)
+				accounts = append(accounts, account)
+
+				fs := webdav.NewMemFS()
+				err := fs.Mkdir(context.Background(), "/docs", 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeMemFile(t, fs, "/docs/file.txt", "content")
+
+				// only the handlers that see root paths, newWebDAVHandler
+				// needs a ProtonFS and wraps more around them
+				var handler http.Handler = &webdav.Handler{
+					Prefix:     account.Prefix(),
+					FileSystem: fs,
+					LockSystem: webdav.NewMemLS(),
+				}
+				handler = withMove(fs, account.Prefix(), handler)
+				handler = withRootGuard(account.Prefix(), handler)
+
+				_, cancel := context.WithCancel(context.Background())
+				account.connect(nil, nil, handler, cancel)
+				filesystems[account] = fs
+			}
+
+			router := withDestination(withWebDAVPrefix(newAccountRouter()))
+
+			for _, account := range accounts {
+				prefix := account.Prefix()
+				fs := filesystems[account]
+
+				roots := []string{prefix + "/", prefix + "/.", prefix + "//", prefix + "/docs/.."}
+				if prefix != "" {
+					roots = append(roots, prefix)
+				}
+
+				for _, root := range roots {
+					w := serveDAV(router, "DELETE", root, nil)
+					if w.Code != http.StatusForbidden {
+						t.Errorf("DELETE %s returned %d, want %d", root, w.Code, http.StatusForbidden)
+					}
+
+					w = serveDAV(router, "MOVE", root, map[string]string{"Destination": prefix + "/moved"})
+					if w.Code != http.StatusForbidden {
+						t.Errorf("MOVE %s returned %d, want %d", root, w.Code, http.StatusForbidden)
+					}
+
+					if _, ok := readMemFile(t, fs, "/docs/file.txt"); !ok {
+						t.Fatalf("the drive of account %q was modified through %s", account.Name, root)
+					}
+				}
+
+				// the guard doesn't get in the way of anything else
+				w := serveDAV(router, "DELETE", prefix+"/docs/file.txt", nil)
+				if w.Code != http.StatusNoContent {
+					t.Errorf("DELETE %s/docs/file.txt returned %d, want %d", prefix, w.Code, http.StatusNoContent)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// healthResponse describes whether the bridge is able to serve requests
+type healthResponse struct {
+	Status        string `json:"status"`
+	LoggedIn      bool   `json:"logged_in"`
+	WebDAVRunning bool   `json:"webdav_running"`
+}
+
+// currentHealth reports the readiness of the bridge. It is ready once every
+// account is logged in and the WebDAV server has been started.
+func currentHealth() healthResponse {
+	health := healthResponse{
+		LoggedIn:      true,
+		WebDAVRunning: webdavRunning.Load(),
+	}
+
+	for _, account := range accounts {
+		account.Status.mu.Lock()
+		if !account.Status.LoggedIn {
+			health.LoggedIn = false
+		}
+		account.Status.mu.Unlock()
+	}
+
+	health.Status = "ok"
+	if !health.LoggedIn || !health.WebDAVRunning {
+		health.Status = "unavailable"
+	}
+
+	return health
+}
+
+// handleHealthz is the liveness probe, it succeeds as long as the process is up
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	health := currentHealth()
+	health.Status = "ok"
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// handleReadyz is the readiness probe, it fails with 503 until the bridge can serve WebDAV requests
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	health := currentHealth()
+
+	w.Header().Set("Content-Type", "application/json")
+	if health.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(health)
+}
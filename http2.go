@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+var (
+	OptHTTP1Only = false
+	OptH2C       = false
+)
+
+// configureHTTP2 sets up the protocols of the WebDAV server. With TLS, HTTP/2
+// is negotiated through ALPN unless -http1-only is set. Cleartext HTTP/2 is
+// only served with -h2c, since some WebDAV clients choke on the upgrade.
+func configureHTTP2(server *http.Server, cert string) error {
+	if OptHTTP1Only {
+		// a non-nil map turns off the HTTP/2 support of net/http
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		return nil
+	}
+
+	h2 := &http2.Server{IdleTimeout: server.IdleTimeout}
+
+	if cert != "" {
+		return http2.ConfigureServer(server, h2)
+	}
+
+	if OptH2C {
+		server.Handler = h2c.NewHandler(server.Handler, h2)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	startTime = time.Now()
+)
+
+// infoResponse describes the running bridge process
+type infoResponse struct {
+	Version       string    `json:"version"`
+	StartTime     time.Time `json:"start_time"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	Uptime        string    `json:"uptime"`
+}
+
+// formatUptime renders a duration as e.g. "2d 3h 4m 5s"
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Second)
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if days > 0 || hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if days > 0 || hours > 0 || minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	parts = append(parts, fmt.Sprintf("%ds", seconds))
+
+	return strings.Join(parts, " ")
+}
+
+func handleInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	uptime := time.Since(startTime)
+
+	info := infoResponse{
+		Version:       AppVersion,
+		StartTime:     startTime,
+		UptimeSeconds: int64(uptime.Seconds()),
+		Uptime:        formatUptime(uptime),
+	}
+
+	err := json.NewEncoder(w).Encode(info)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
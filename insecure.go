@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	OptAllowInsecure = false
+)
+
+// isLocalAddress reports whether a server listening on addr can only be
+// reached from this machine
+func isLocalAddress(addr string) bool {
+	if strings.HasPrefix(addr, UnixSocketPrefix) {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkInsecureListen refuses to serve WebDAV without authentication on an
+// address other machines can reach, unless -allow-insecure is given. Access
+// tokens count as authentication, so they must be loaded first.
+func checkInsecureListen() error {
+	if OptWebDAVUser != "" || !accessTokens.Empty() || OptTLSClientCA != "" || OptAllowInsecure {
+		return nil
+	}
+
+	for _, addr := range OptListen {
+		if isLocalAddress(addr) {
+			continue
+		}
+
+		return fmt.Errorf("refusing to serve WebDAV on %s without authentication: "+
+			"set -webdav-user and -webdav-pass, listen on a loopback address, or pass -allow-insecure", addr)
+	}
+
+	return nil
+}
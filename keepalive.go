@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+var (
+	OptKeepAlive = 15 * time.Minute
+)
+
+// keepSessionAlive fetches the root folder of the drive periodically, so the
+// session of an idle account doesn't go stale. If Proton rejects the tokens,
+// the account is handled like any other expired session.
+func keepSessionAlive(ctx context.Context, account *Account, session *drive.Session) {
+	if OptKeepAlive <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(OptKeepAlive)
+	defer ticker.Stop()
+
+	share := session.Links().Share()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := session.Client().GetLink(ctx, share.ID(), share.LinkID())
+		if ctx.Err() != nil {
+			return
+		}
+
+		if isAuthRejected(err) {
+			account.Log().Warn("Keep-alive was rejected by Proton", "error", err)
+			expireTokens(account)
+			return
+		}
+
+		if err != nil {
+			account.Log().Warn("Keep-alive failed", "error", err)
+			continue
+		}
+
+		account.Log().Debug("Session is alive")
+	}
+}
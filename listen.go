@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	UnixSocketPrefix = "unix:"
+	UnixSocketMode   = 0660
+)
+
+// listen opens a listener for addr, which is either a TCP address or a Unix
+// domain socket in the form unix:/path/to/socket. A stale socket left behind
+// by a previous run is removed first. The socket file is removed again when
+// the listener is closed.
+func listen(addr string) (net.Listener, error) {
+	file, ok := strings.CutPrefix(addr, UnixSocketPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	info, err := os.Lstat(file)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", file)
+		}
+
+		err = os.Remove(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(file, UnixSocketMode)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// validateAddress checks that addr is a TCP address with a port or a Unix socket
+func validateAddress(addr string) error {
+	if file, ok := strings.CutPrefix(addr, UnixSocketPrefix); ok {
+		if file == "" {
+			return fmt.Errorf("invalid address %q: missing socket path", addr)
+		}
+
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	_, err = net.LookupPort("tcp", port)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	return nil
+}
+
+// addressList is a flag that can be given multiple times, each value may hold
+// several comma-separated addresses. The first value replaces the default.
+type addressList struct {
+	target *[]string
+	set    bool
+}
+
+func newAddressList(target *[]string) *addressList {
+	return &addressList{target: target}
+}
+
+func (self *addressList) String() string {
+	if self.target == nil {
+		return ""
+	}
+
+	return strings.Join(*self.target, ",")
+}
+
+func (self *addressList) Set(value string) error {
+	if !self.set {
+		*self.target = nil
+		self.set = true
+	}
+
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+
+		*self.target = append(*self.target, addr)
+	}
+
+	return nil
+}
+
+// serverURL returns the URL a server listening on addr is reachable with
+func serverURL(cert, addr, path string) string {
+	if strings.HasPrefix(addr, UnixSocketPrefix) {
+		return addr
+	}
+
+	return fmt.Sprintf("%s://%s%s", urlScheme(cert), addr, path)
+}
+
+// serverURLs returns the URLs of a server listening on several addresses
+func serverURLs(cert string, addrs []string, path string) string {
+	var urls []string
+	for _, addr := range addrs {
+		urls = append(urls, serverURL(cert, addr, path))
+	}
+
+	return strings.Join(urls, ", ")
+}
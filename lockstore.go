@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/StollD/webdav"
+)
+
+var (
+	OptLockStore = LockStoreMemory
+)
+
+const (
+	LockStoreMemory = "memory"
+	LockStoreFile   = "file"
+)
+
+// newLockSystem creates the WebDAV lock system of an account, as selected
+// with -lock-store
+func newLockSystem(account *Account) webdav.LockSystem {
+	if OptLockStore != LockStoreFile {
+		return webdav.NewMemLS()
+	}
+
+	file, err := dataFile(account.DataFile("locks.json"))
+	if err != nil {
+		account.Log().Error("Error opening lock store, locks are kept in memory", "error", err)
+		return webdav.NewMemLS()
+	}
+
+	ls := newFileLS(file)
+
+	err = ls.load(time.Now())
+	if err != nil && !os.IsNotExist(err) {
+		account.Log().Error("Error loading locks", "error", err)
+	}
+
+	return ls
+}
+
+var _ webdav.LockSystem = &fileLS{}
+
+// fileLS is a lock system that writes its locks to a file, so they survive
+// a restart of the bridge. Locks without a timeout are only kept in memory,
+// which includes the ones the WebDAV handler takes for the duration of a
+// single request: a crash would otherwise leave them behind forever.
+type fileLS struct {
+	file  string
+	locks map[string]*fileLock
+	mu    sync.Mutex
+}
+
+// fileLock is a single lock, as stored in the lock file
+type fileLock struct {
+	Token     string        `json:"token"`
+	Root      string        `json:"root"`
+	Duration  time.Duration `json:"duration"`
+	OwnerXML  string        `json:"owner_xml"`
+	ZeroDepth bool          `json:"zero_depth"`
+	Expires   time.Time     `json:"expires"`
+
+	held bool
+}
+
+func newFileLS(file string) *fileLS {
+	return &fileLS{
+		file:  file,
+		locks: map[string]*fileLock{},
+	}
+}
+
+func (self *fileLock) details() webdav.LockDetails {
+	return webdav.LockDetails{
+		Root:      self.Root,
+		Duration:  self.Duration,
+		OwnerXML:  self.OwnerXML,
+		ZeroDepth: self.ZeroDepth,
+	}
+}
+
+func (self *fileLock) persistent() bool {
+	return self.Duration >= 0
+}
+
+func (self *fileLock) expired(now time.Time) bool {
+	return self.persistent() && now.After(self.Expires)
+}
+
+// covers reports whether the lock applies to name
+func (self *fileLock) covers(name string) bool {
+	if name == self.Root {
+		return true
+	}
+
+	return !self.ZeroDepth && pathHasPrefix(name, self.Root)
+}
+
+// load restores the locks from the lock file, dropping expired ones
+func (self *fileLS) load(now time.Time) error {
+	data, err := os.ReadFile(self.file)
+	if err != nil {
+		return err
+	}
+
+	var locks []*fileLock
+
+	err = json.Unmarshal(data, &locks)
+	if err != nil {
+		return err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, lock := range locks {
+		if lock.persistent() && !lock.expired(now) {
+			self.locks[lock.Token] = lock
+		}
+	}
+
+	slog.Debug("Restored WebDAV locks", "file", self.file, "locks", len(self.locks))
+	return nil
+}
+
+// save writes the persistent locks to the lock file. The caller must hold mu.
+func (self *fileLS) save() {
+	locks := []*fileLock{}
+	for _, lock := range self.locks {
+		if lock.persistent() {
+			locks = append(locks, lock)
+		}
+	}
+
+	data, err := json.Marshal(locks)
+	if err == nil {
+		err = replaceFile(self.file, data, false)
+	}
+
+	if err != nil {
+		slog.Error("Error saving WebDAV locks", "file", self.file, "error", err)
+	}
+}
+
+// collectExpired removes expired locks. The caller must hold mu.
+func (self *fileLS) collectExpired(now time.Time) {
+	changed := false
+
+	for token, lock := range self.locks {
+		if !lock.held && lock.expired(now) {
+			delete(self.locks, token)
+			changed = true
+		}
+	}
+
+	if changed {
+		self.save()
+	}
+}
+
+// lookup returns the lock among the conditions that applies to name and is
+// not held by another request. The caller must hold mu.
+func (self *fileLS) lookup(name string, conditions ...webdav.Condition) *fileLock {
+	for _, c := range conditions {
+		lock := self.locks[c.Token]
+		if lock != nil && !lock.held && lock.covers(name) {
+			return lock
+		}
+	}
+
+	return nil
+}
+
+func (self *fileLS) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.collectExpired(now)
+
+	var lock0, lock1 *fileLock
+
+	if name0 != "" {
+		lock0 = self.lookup(path.Clean("/"+name0), conditions...)
+		if lock0 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+
+	if name1 != "" {
+		lock1 = self.lookup(path.Clean("/"+name1), conditions...)
+		if lock1 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+
+	// don't hold the same lock twice
+	if lock1 == lock0 {
+		lock1 = nil
+	}
+
+	for _, lock := range []*fileLock{lock0, lock1} {
+		if lock != nil {
+			lock.held = true
+		}
+	}
+
+	return func() {
+		self.mu.Lock()
+		defer self.mu.Unlock()
+
+		for _, lock := range []*fileLock{lock0, lock1} {
+			if lock != nil {
+				lock.held = false
+			}
+		}
+	}, nil
+}
+
+func (self *fileLS) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.collectExpired(now)
+
+	root := path.Clean("/" + details.Root)
+
+	for _, lock := range self.locks {
+		if lock.covers(root) {
+			return "", webdav.ErrLocked
+		}
+
+		// a lock of infinite depth can't cover an existing lock
+		if !details.ZeroDepth && pathHasPrefix(lock.Root, root) {
+			return "", webdav.ErrLocked
+		}
+	}
+
+	token, err := newLockToken()
+	if err != nil {
+		return "", err
+	}
+
+	lock := &fileLock{
+		Token:     token,
+		Root:      root,
+		Duration:  details.Duration,
+		OwnerXML:  details.OwnerXML,
+		ZeroDepth: details.ZeroDepth,
+	}
+
+	if lock.persistent() {
+		lock.Expires = now.Add(details.Duration)
+	}
+
+	self.locks[token] = lock
+
+	if lock.persistent() {
+		self.save()
+	}
+
+	return token, nil
+}
+
+func (self *fileLS) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.collectExpired(now)
+
+	lock := self.locks[token]
+	if lock == nil {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+
+	if lock.held {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+
+	persistent := lock.persistent()
+
+	lock.Duration = duration
+	if lock.persistent() {
+		lock.Expires = now.Add(duration)
+	}
+
+	if persistent || lock.persistent() {
+		self.save()
+	}
+
+	return lock.details(), nil
+}
+
+func (self *fileLS) Unlock(now time.Time, token string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.collectExpired(now)
+
+	lock := self.locks[token]
+	if lock == nil {
+		return webdav.ErrNoSuchLock
+	}
+
+	if lock.held {
+		return webdav.ErrLocked
+	}
+
+	delete(self.locks, token)
+
+	if lock.persistent() {
+		self.save()
+	}
+
+	return nil
+}
+
+// newLockToken generates a random lock token that stays unique across restarts
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	id := hex.EncodeToString(b)
+	return fmt.Sprintf("opaquelocktoken:%s-%s-%s-%s-%s", id[0:8], id[8:12], id[12:16], id[16:20], id[20:]), nil
+}
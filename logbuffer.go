@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	OptLogBuffer = 1000
+	logBuffer    *LogBuffer
+)
+
+// LogEntry is a log message kept in the log buffer
+type LogEntry struct {
+	Time    time.Time      `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// LogBuffer keeps the most recent log messages in memory, so they can be
+// read through the admin API
+type LogBuffer struct {
+	entries []LogEntry
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{entries: make([]LogEntry, size)}
+}
+
+func (self *LogBuffer) add(entry LogEntry) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.entries[self.next] = entry
+	self.next = (self.next + 1) % len(self.entries)
+
+	if self.next == 0 {
+		self.full = true
+	}
+}
+
+// Entries returns the buffered messages of at least level, oldest first
+func (self *LogBuffer) Entries(level slog.Level) []LogEntry {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	ordered := make([]LogEntry, 0, len(self.entries))
+	if self.full {
+		ordered = append(ordered, self.entries[self.next:]...)
+	}
+	ordered = append(ordered, self.entries[:self.next]...)
+
+	entries := []LogEntry{}
+	for _, entry := range ordered {
+		var entryLevel slog.Level
+		if entryLevel.UnmarshalText([]byte(entry.Level)) == nil && entryLevel < level {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// bufferHandler passes log records on to the actual handler and keeps a copy
+// of them in the log buffer
+type bufferHandler struct {
+	next   slog.Handler
+	buffer *LogBuffer
+
+	attrs []slog.Attr
+	group string
+}
+
+var _ slog.Handler = &bufferHandler{}
+
+func (self *bufferHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return self.next.Enabled(ctx, level)
+}
+
+func (self *bufferHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := map[string]any{}
+	for _, attr := range self.attrs {
+		addLogField(fields, "", attr)
+	}
+
+	record.Attrs(func(attr slog.Attr) bool {
+		addLogField(fields, self.group, attr)
+		return true
+	})
+
+	self.buffer.add(LogEntry{
+		Time:    record.Time,
+		Level:   record.Level.String(),
+		Message: record.Message,
+		Fields:  fields,
+	})
+
+	return self.next.Handle(ctx, record)
+}
+
+func (self *bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := make([]slog.Attr, 0, len(self.attrs)+len(attrs))
+	prefixed = append(prefixed, self.attrs...)
+
+	for _, attr := range attrs {
+		if self.group != "" {
+			attr.Key = self.group + "." + attr.Key
+		}
+
+		prefixed = append(prefixed, attr)
+	}
+
+	return &bufferHandler{
+		next:   self.next.WithAttrs(attrs),
+		buffer: self.buffer,
+		attrs:  prefixed,
+		group:  self.group,
+	}
+}
+
+func (self *bufferHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return self
+	}
+
+	group := name
+	if self.group != "" {
+		group = self.group + "." + name
+	}
+
+	return &bufferHandler{
+		next:   self.next.WithGroup(name),
+		buffer: self.buffer,
+		attrs:  self.attrs,
+		group:  group,
+	}
+}
+
+// addLogField stores attr in fields, with the keys of groups joined by dots
+// like the text handler does
+func addLogField(fields map[string]any, group string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+
+	key := attr.Key
+	if group != "" && key != "" {
+		key = group + "." + key
+	} else if key == "" {
+		key = group
+	}
+
+	if value.Kind() == slog.KindGroup {
+		for _, child := range value.Group() {
+			addLogField(fields, key, child)
+		}
+		return
+	}
+
+	if key == "" {
+		return
+	}
+
+	switch value.Kind() {
+	case slog.KindDuration:
+		fields[key] = value.Duration().String()
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			fields[key] = v.Error()
+		case fmt.Stringer:
+			fields[key] = v.String()
+		default:
+			fields[key] = v
+		}
+	default:
+		fields[key] = value.Any()
+	}
+}
+
+// handleAdminLogs returns the buffered log messages. The level query
+// parameter filters out less severe messages, limit returns only the most
+// recent ones.
+func handleAdminLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if logBuffer == nil {
+		http.Error(w, "The log buffer is disabled", http.StatusNotFound)
+		return
+	}
+
+	level := slog.LevelDebug
+	if value := r.URL.Query().Get("level"); value != "" {
+		err := level.UnmarshalText([]byte(strings.ToLower(value)))
+		if err != nil {
+			http.Error(w, "Invalid level", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries := logBuffer.Entries(level)
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		if limit < len(entries) {
+			entries = entries[len(entries)-limit:]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
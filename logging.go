@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+var (
+	OptLogFormat = "text"
+	OptLogLevel  = "info"
+)
+
+// setupLogging installs the default logger according to -log-format and -log-level
+func setupLogging() error {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(OptLogLevel))
+	if err != nil {
+		return fmt.Errorf("invalid value for -log-level: %q", OptLogLevel)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch OptLogFormat {
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	default:
+		return fmt.Errorf("invalid value for -log-format: %q", OptLogFormat)
+	}
+
+	if OptLogBuffer < 0 {
+		return fmt.Errorf("-log-buffer must not be negative")
+	}
+
+	if OptLogBuffer > 0 {
+		logBuffer = NewLogBuffer(OptLogBuffer)
+		handler = &bufferHandler{next: handler, buffer: logBuffer}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+// LoginMode is a way of logging into Proton. A mode only has to log the
+// application in, login takes care of the status of the account and of
+// storing the tokens.
+type LoginMode interface {
+	// Name identifies the mode in logs, e.g. password or tokens
+	Name() string
+
+	// Login logs app into Proton. If it fails, the returned code is one of
+	// the LoginError codes, or empty if none applies.
+	Login(ctx context.Context, account *Account, app *drive.Application) (string, error)
+}
+
+// login logs an account into Proton with the given mode and stores the new
+// tokens, without starting the WebDAV server
+func login(account *Account, mode LoginMode) error {
+	account.Status.mu.Lock()
+	account.Status.State = StateLoggingIn
+	account.Status.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	app := drive.NewApplication(AppVersion)
+
+	code, err := mode.Login(ctx, account, app)
+	if err != nil {
+		account.Status.mu.Lock()
+		account.Status.State = StateError
+		account.Status.LoggedIn = false
+		account.Status.NeedsLogin = true
+		account.Status.Error = err.Error()
+		account.Status.ErrorCode = code
+		account.Status.Needs2FA = code == LoginError2FARequired || code == LoginError2FAInvalid
+		account.Status.mu.Unlock()
+		account.stateChanged()
+		return err
+	}
+
+	err = storeTokens(account, *app.Tokens())
+	if err != nil {
+		return err
+	}
+
+	account.Status.mu.Lock()
+	account.Status.State = StateConnecting
+	account.Status.LoggedIn = true
+	account.Status.LastLogin = time.Now()
+	account.Status.NeedsLogin = false
+	account.Status.Error = ""
+	account.Status.ErrorCode = ""
+	account.Status.Needs2FA = false
+	account.Status.mu.Unlock()
+
+	account.Log().Info("Login successful", "mode", mode.Name())
+	return nil
+}
+
+// passwordLogin logs in with the username and password of the account
+type passwordLogin struct {
+	credentials drive.Credentials
+}
+
+func (self passwordLogin) Name() string {
+	return "password"
+}
+
+func (self passwordLogin) Login(ctx context.Context, account *Account, app *drive.Application) (string, error) {
+	err := validateCredentials(self.credentials.Username, self.credentials.Password)
+	if errors.Is(err, ErrUsernameEmpty) {
+		return LoginErrorCredentials, fmt.Errorf("%w: set %s or enter your Proton username", err, account.EnvName("USERNAME"))
+	}
+	if errors.Is(err, ErrPasswordEmpty) {
+		return LoginErrorCredentials, fmt.Errorf("%w: set %s or enter your Proton password", err, account.EnvName("PASSWORD"))
+	}
+
+	account.Status.mu.Lock()
+	awaiting2FA := account.Status.Needs2FA && self.credentials.TwoFA != ""
+	account.Status.mu.Unlock()
+
+	err = app.LoginWithCredentials(ctx, self.credentials)
+	if err != nil {
+		return loginErrorCode(err, awaiting2FA), err
+	}
+
+	return "", nil
+}
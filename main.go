@@ -4,24 +4,24 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
 	"embed"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	drive "github.com/StollD/proton-drive"
 	"github.com/StollD/webdav"
-	"github.com/adrg/xdg"
 	"gitlab.com/david_mbuvi/go_asterisks"
 )
 
@@ -33,13 +33,21 @@ const (
 
 var (
 	OptLogin       = false
-	OptListen      = "127.0.0.1:7984"
+	OptListen      = []string{"127.0.0.1:7984"}
 	OptAdminListen = "127.0.0.1:7985"
-	authStatus     = &AuthStatus{LoggedIn: false}
+	OptNoAdmin     = false
 	webdavServer   *http.Server
-	webdavCancel   context.CancelFunc
 	webdavMutex    sync.Mutex
+	webdavRunning  atomic.Bool
 	adminAuth      = &AdminAuth{initialized: false}
+
+	// addresses the WebDAV server listens on, guarded by webdavMutex
+	webdavAddresses []string
+)
+
+var (
+	ErrUsernameEmpty = errors.New("username is empty")
+	ErrPasswordEmpty = errors.New("password is empty")
 )
 
 // embed static files
@@ -48,26 +56,52 @@ var staticFiles embed.FS
 
 // authStatus keeps track of the current authentication state
 type AuthStatus struct {
-	LoggedIn    bool      `json:"logged_in"`
-	LastLogin   time.Time `json:"last_login,omitempty"`
-	NeedsLogin  bool      `json:"needs_login"`
-	Error       string    `json:"error,omitempty"`
-	mu          sync.Mutex
+	Account         string    `json:"account,omitempty"`
+	State           string    `json:"state"`
+	LoggedIn        bool      `json:"logged_in"`
+	LastLogin       time.Time `json:"last_login,omitempty"`
+	NeedsLogin      bool      `json:"needs_login"`
+	ReadOnly        bool      `json:"read_only"`
+	Error           string    `json:"error,omitempty"`
+	ErrorCode       string    `json:"error_code,omitempty"`
+	Needs2FA        bool      `json:"needs_2fa"`
+	WebDAVRunning   bool      `json:"webdav_running"`
+	WebDAVAddresses []string  `json:"webdav_addresses,omitempty"`
+	TokenWarning    string    `json:"token_warning,omitempty"`
+	mu              sync.Mutex
+
+	// the last state reported to -notify-url
+	notifiedState string
+	notifiedError string
 }
 
+// States of an account, so the admin UI can tell why it isn't connected
+const (
+	StateNeverLoggedIn = "never_logged_in"
+	StateLoggingIn     = "logging_in"
+	StateConnecting    = "connecting"
+	StateConnected     = "connected"
+	StateTokensExpired = "tokens_expired"
+	StateLoggedOut     = "logged_out"
+	StateError         = "error"
+)
+
 // AdminAuth keeps track of admin authentication
 type AdminAuth struct {
 	initialized bool
 	passwordHash string
-	salt string
-	sessions map[string]time.Time
+	salt string // only set for legacy SHA-256 hashes
+	sessions map[string]*adminSession
+	setupToken string // required to set the password while uninitialized
 	mu sync.Mutex
 }
 
 // AdminPasswordData represents stored password data
 type AdminPasswordData struct {
 	PasswordHash string `json:"password_hash"`
-	Salt         string `json:"salt"`
+	// Salt is only present in files written by older versions, which used
+	// salted SHA-256 instead of bcrypt
+	Salt string `json:"salt,omitempty"`
 }
 
 // loginRequest represents login form data
@@ -85,7 +119,14 @@ type adminLoginRequest struct {
 
 // adminSetupRequest represents admin setup data
 type adminSetupRequest struct {
-	Password string `json:"password"`
+	Password   string `json:"password"`
+	SetupToken string `json:"setup_token"`
+}
+
+// adminChangePasswordRequest represents a change of the admin password
+type adminChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 // adminStatusResponse represents admin status
@@ -93,18 +134,22 @@ type adminStatusResponse struct {
 	Initialized bool `json:"initialized"`
 }
 
-// get credential from environment or prompt user
+// get credential from the credential providers or prompt user
 func getCredential(envVar, prompt, hint string, masked bool) (string, error) {
-	// try to get from environment first
-	if value := os.Getenv(envVar); value != "" {
+	// try the environment, files and commands first
+	if value, ok, err := lookupCredential(envVar); ok {
+		if err != nil {
+			return "", err
+		}
+
 		// special case: "false" for optional credentials means skip/empty
-		if value == "false" && (envVar == "PROTON_MAILBOX_PASSWORD" || envVar == "PROTON_2FA") {
+		if value == "false" && (strings.HasSuffix(envVar, "_MAILBOX_PASSWORD") || strings.HasSuffix(envVar, "_2FA")) {
 			return "", nil
 		}
 		return value, nil
 	}
 
-	// if not in environment, prompt user
+	// if no provider has it, prompt user
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println(prompt)
 	if hint != "" {
@@ -123,132 +168,115 @@ func getCredential(envVar, prompt, hint string, masked bool) (string, error) {
 	return strings.TrimSpace(value), err
 }
 
-func doLogin() error {
-	user, err := getCredential("PROTON_USERNAME", "Enter the username of your Proton Drive account.", "", false)
+func doLogin(account *Account) error {
+	user, err := getCredential(account.EnvName("USERNAME"), "Enter the username of your Proton Drive account.", "", false)
 	if err != nil {
 		return err
 	}
 
-	pass, err := getCredential("PROTON_PASSWORD", "Enter the password of your Proton Drive account.", "", true)
+	pass, err := getCredential(account.EnvName("PASSWORD"), "Enter the password of your Proton Drive account.", "", true)
 	if err != nil {
 		return err
 	}
 
-	mailbox, err := getCredential("PROTON_MAILBOX_PASSWORD", "Enter the mailbox password of your Proton Drive account.", "If you don't have a mailbox password, press enter.", true)
+	mailbox, err := getCredential(account.EnvName("MAILBOX_PASSWORD"), "Enter the mailbox password of your Proton Drive account.", "If you don't have a mailbox password, press enter.", true)
 	if err != nil {
 		return err
 	}
 
-	twoFA, err := getCredential("PROTON_2FA", "Enter a valid 2FA token for your Proton Drive account.", "If you don't have 2FA setup, press enter.", false)
+	twoFA, err := getCredential(account.EnvName("2FA"), "Enter a valid 2FA token for your Proton Drive account.", "If you don't have 2FA setup, press enter.", false)
 	if err != nil {
 		return err
 	}
 
-	return loginWithCredentials(user, pass, mailbox, twoFA)
+	return loginWithCredentials(account, user, pass, mailbox, twoFA)
 }
 
-func loginWithCredentials(username, password, mailboxPassword, twoFA string) error {
-	credentials := drive.Credentials{
-		Username:        username,
-		Password:        password,
-		MailboxPassword: mailboxPassword,
-		TwoFA:           twoFA,
+// validateCredentials rejects required credentials that are empty or only whitespace
+func validateCredentials(username, password string) error {
+	if strings.TrimSpace(username) == "" {
+		return ErrUsernameEmpty
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	app := drive.NewApplication(AppVersion)
-	err := app.LoginWithCredentials(ctx, credentials)
-	if err != nil {
-		authStatus.mu.Lock()
-		authStatus.LoggedIn = false
-		authStatus.NeedsLogin = true
-		authStatus.Error = err.Error()
-		authStatus.mu.Unlock()
-		return err
+	if strings.TrimSpace(password) == "" {
+		return ErrPasswordEmpty
 	}
 
-	err = storeTokens(*app.Tokens())
+	return nil
+}
+
+func loginWithCredentials(account *Account, username, password, mailboxPassword, twoFA string) error {
+	err := authenticate(account, username, password, mailboxPassword, twoFA)
 	if err != nil {
 		return err
 	}
 
-	authStatus.mu.Lock()
-	authStatus.LoggedIn = true
-	authStatus.LastLogin = time.Now()
-	authStatus.NeedsLogin = false
-	authStatus.Error = ""
-	authStatus.mu.Unlock()
-
-	fmt.Println("Login successful.")
-	
 	// Start the WebDAV server with the new tokens
-	go startWebDAVServer()
-	
+	go startWebDAVServer(account)
+
 	return nil
 }
 
-func canAutoLogin() bool {
-	return os.Getenv("PROTON_USERNAME") != "" && 
-	       os.Getenv("PROTON_PASSWORD") != "" 
+// authenticate logs into Proton Drive and stores the tokens of the account,
+// without starting the WebDAV server
+func authenticate(account *Account, username, password, mailboxPassword, twoFA string) error {
+	return login(account, passwordLogin{credentials: drive.Credentials{
+		Username:        strings.TrimSpace(username),
+		Password:        password,
+		MailboxPassword: mailboxPassword,
+		TwoFA:           twoFA,
+	}})
+}
+
+func canAutoLogin(account *Account) bool {
+	return hasCredential(account.EnvName("USERNAME")) && 
+	       hasCredential(account.EnvName("PASSWORD")) 
 }
 
 func doListen() error {
 	// Check for admin password reset
 	if os.Getenv("ADMIN_PASSWORD_RESET") == "true" {
-		fmt.Println("Admin password reset requested, removing password file...")
+		slog.Info("Admin password reset requested, removing password file")
 		resetAdminPassword()
 	}
 
+	// Remove leftovers of interrupted writes and surplus backups
+	cleanupDataFiles()
+
+	err := bootstrapAdminPassword()
+	if err != nil {
+		return err
+	}
+
 	// Initialize admin auth
 	initAdminAuth()
 
-	// Always start the admin server first
-	go startAdminServer()
-	
-	tokens, err := loadTokens()
-	autoLoginAvailable := canAutoLogin()
-	
+	// Hash the WebDAV credentials, or warn that the share is open
+	err = initWebDAVAuth()
 	if err != nil {
-		authStatus.mu.Lock()
-		authStatus.LoggedIn = false
-		authStatus.NeedsLogin = true
-		authStatus.Error = "No valid tokens found"
-		authStatus.mu.Unlock()
-		
-		fmt.Println("Failed to load tokens!")
-		fmt.Println("Use the web UI to login or set environment variables.")
-		fmt.Println(fmt.Sprintf("Admin interface available at http://%s", OptAdminListen))
-		
-		if autoLoginAvailable {
-			// Auto-login using environment variables
-			fmt.Println("Attempting automatic login with environment variables...")
-			if err := doLogin(); err != nil {
-				fmt.Println("Automatic login failed:", err)
-				// Wait indefinitely - admin server is running
-				waitForever()
-				return nil
-			}
-		} else {
-			// Wait indefinitely - admin server is running
-			waitForever()
-			return nil
-		}
-	} else if tokens.AccessToken != "" {
-		// We have tokens, start the WebDAV server
-		authStatus.mu.Lock()
-		authStatus.LoggedIn = true
-		authStatus.LastLogin = time.Now()
-		authStatus.NeedsLogin = false
-		authStatus.mu.Unlock()
-		
-		// Start WebDAV server with existing tokens
-		go startWebDAVServer()
+		return err
 	}
 
-	// Wait indefinitely - both servers are running
-	waitForever()
+	logWindowsCompat()
+	initBandwidthLimits()
+
+	// Periodically back up tokens and admin password, if configured
+	go runBackups()
+
+	// Always start the admin server first, unless it is disabled
+	if OptNoAdmin {
+		slog.Info("Admin interface disabled, accounts can only log in with environment variables")
+	} else {
+		go startAdminServer()
+	}
+	
+	// Resume or log in every account in the background
+	for _, account := range accounts {
+		go startAccount(account)
+	}
+
+	// Wait indefinitely - the servers are running
+	waitForShutdown()
 	return nil
 }
 
@@ -258,13 +286,14 @@ func initAdminAuth() {
 	defer adminAuth.mu.Unlock()
 
 	// Initialize sessions map
-	adminAuth.sessions = make(map[string]time.Time)
+	adminAuth.sessions = make(map[string]*adminSession)
 
 	// Try to load existing password data
 	data, err := loadAdminPassword()
 	if err != nil {
 		// No password set yet, will show setup screen
 		adminAuth.initialized = false
+		initSetupToken()
 		return
 	}
 
@@ -276,10 +305,10 @@ func initAdminAuth() {
 
 // resetAdminPassword deletes the admin password file to reset it
 func resetAdminPassword() {
-	file, err := xdg.DataFile(AdminPasswordFile)
+	file, err := dataFile(AdminPasswordFile)
 	if err == nil {
 		os.Remove(file)
-		fmt.Println("Admin password has been reset.")
+		slog.Info("Admin password has been reset")
 	}
 	
 	// Reset the in-memory state
@@ -287,7 +316,7 @@ func resetAdminPassword() {
 	adminAuth.initialized = false
 	adminAuth.passwordHash = ""
 	adminAuth.salt = ""
-	adminAuth.sessions = make(map[string]time.Time)
+	adminAuth.sessions = make(map[string]*adminSession)
 	adminAuth.mu.Unlock()
 }
 
@@ -295,7 +324,7 @@ func resetAdminPassword() {
 func loadAdminPassword() (AdminPasswordData, error) {
 	var data AdminPasswordData
 
-	file, err := xdg.DataFile(AdminPasswordFile)
+	file, err := dataFile(AdminPasswordFile)
 	if err != nil {
 		return data, err
 	}
@@ -315,40 +344,39 @@ func loadAdminPassword() (AdminPasswordData, error) {
 
 // storeAdminPassword saves the admin password data
 func storeAdminPassword(data AdminPasswordData) error {
-	file, err := xdg.DataFile(AdminPasswordFile)
+	file, err := dataFile(AdminPasswordFile)
 	if err != nil {
 		return err
 	}
 
-	// Ensure the directory exists
-	dir := filepath.Dir(file)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
-	}
-
 	enc, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(file, enc, 0600)
+	return writeDataFile(file, enc)
 }
 
-// generateSalt creates a random salt for password hashing
-func generateSalt() (string, error) {
-	b := make([]byte, 16)
-	_, err := rand.Read(b)
+// upgradeAdminPassword replaces a legacy SHA-256 hash with a bcrypt hash
+func upgradeAdminPassword(password string) {
+	passwordHash, err := hashPassword(password)
 	if err != nil {
-		return "", err
+		slog.Error("Error upgrading admin password hash", "error", err)
+		return
+	}
+
+	err = storeAdminPassword(AdminPasswordData{PasswordHash: passwordHash})
+	if err != nil {
+		slog.Error("Error upgrading admin password hash", "error", err)
+		return
 	}
-	return base64.StdEncoding.EncodeToString(b), nil
-}
 
-// hashPassword creates a salted hash of the password
-func hashPassword(password, salt string) string {
-	hash := sha256.New()
-	hash.Write([]byte(password + salt))
-	return hex.EncodeToString(hash.Sum(nil))
+	adminAuth.mu.Lock()
+	adminAuth.passwordHash = passwordHash
+	adminAuth.salt = ""
+	adminAuth.mu.Unlock()
+
+	slog.Info("Upgraded admin password hash to bcrypt")
 }
 
 // generateSessionToken creates a new session token
@@ -361,164 +389,410 @@ func generateSessionToken() (string, error) {
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
-// startWebDAVServer starts the WebDAV server with current tokens
-func startWebDAVServer() {
-	webdavMutex.Lock()
-	defer webdavMutex.Unlock()
+// startWebDAVServer connects an account to Proton Drive with its stored
+// tokens and serves it over WebDAV
+func startWebDAVServer(account *Account) {
+	startWebDAVServerWithTokens(account, nil)
+}
+
+// startWebDAVServerWithTokens connects an account with tokens, or with the
+// stored ones if tokens is nil. Tokens that were just refreshed are passed
+// in directly, since the stored ones are already invalid if they couldn't
+// be replaced.
+func startWebDAVServerWithTokens(account *Account, tokens *drive.Tokens) {
+	// a new connection replaces one that is still being retried
+	account.cancelConnect()
+
+	account.connecting.Lock()
+	defer account.connecting.Unlock()
 	
-	// Stop the existing server if it's running
-	if webdavServer != nil {
-		stopWebDAVServer()
-	}
+	// Drop the existing session if there is one
+	stopWebDAVServer(account)
 	
-	tokens, err := loadTokens()
+	if tokens == nil {
+		stored, err := loadTokens(account)
+		if err != nil {
+			account.Log().Error("Error loading tokens", "error", err)
+			return
+		}
+
+		tokens = &stored
+	}
+
+	// Create a context that can be canceled when we need to stop serving the account
+	ctx, cancel := context.WithCancel(context.Background())
+	account.connectStarted(cancel)
+	defer account.connectDone()
+
+	account.Log().Info("Waiting for network")
+
+	err := WaitNetwork(ctx, account.Log())
 	if err != nil {
-		fmt.Println("Error loading tokens:", err)
+		cancel()
+
+		if errors.Is(err, context.Canceled) {
+			account.Log().Info("Stopped connecting to Proton Drive")
+			return
+		}
+
+		account.Log().Error("Error waiting for network", "error", err)
+
+		account.Status.mu.Lock()
+		account.Status.State = StateError
+		account.Status.Error = err.Error()
+		account.Status.mu.Unlock()
+		account.stateChanged()
 		return
 	}
 
-	fmt.Println("Waiting for network ...")
-	WaitNetwork()
-
-	fmt.Println("Connecting to Proton Drive ...")
+	account.Log().Info("Connecting to Proton Drive")
 
-	// Create a context that can be canceled when we need to stop the server
-	var ctx context.Context
-	ctx, webdavCancel = context.WithCancel(context.Background())
+	account.Status.mu.Lock()
+	account.Status.State = StateConnecting
+	account.Status.mu.Unlock()
 
 	app := drive.NewApplication(AppVersion)
-	app.LoginWithTokens(&tokens)
+	app.LoginWithTokens(tokens)
 
 	app.OnTokensUpdated(func(tokens *drive.Tokens) {
-		err := storeTokens(*tokens)
+		err := storeTokens(account, *tokens)
 		if err == nil {
 			return
 		}
 
-		fmt.Println("Error storing tokens:", err)
+		account.Log().Error("Error storing tokens", "error", err)
 	})
 
 	app.OnTokensExpired(func() {
-		fmt.Println("Tokens expired!")
-		
-		authStatus.mu.Lock()
-		authStatus.LoggedIn = false
-		authStatus.NeedsLogin = true
-		authStatus.Error = "Tokens expired"
-		authStatus.mu.Unlock()
-		
-		// Stop the WebDAV server since tokens are expired
-		stopWebDAVServer()
-		
-		if canAutoLogin() {
-			fmt.Println("Attempting to renew tokens with environment variables...")
-			if err := doLogin(); err != nil {
-				fmt.Println("Error renewing tokens:", err)
-			}
-		} else {
-			fmt.Println("Please login via the web UI to renew tokens.")
-		}
+		expireTokens(account)
 	})
 
-	session := drive.NewSession(app)
+	session, err := initSession(ctx, account, app)
+	if err != nil {
+		cancel()
+
+		if errors.Is(err, context.Canceled) {
+			account.Log().Info("Stopped connecting to Proton Drive")
+			return
+		}
+
+		message := describeSessionError(err)
+		account.Log().Error("Error initializing session", "error", message)
+
+		account.Status.mu.Lock()
+		account.Status.State = StateError
+		account.Status.Error = message
+		account.Status.mu.Unlock()
+		account.stateChanged()
+		return
+	}
 
-	err = session.Init(ctx)
+	err = checkRootPath(session)
 	if err != nil {
-		fmt.Println("Error initializing session:", err)
+		cancel()
+		account.Log().Error("Error initializing session", "error", err)
+
+		account.Status.mu.Lock()
+		account.Status.State = StateError
+		account.Status.Error = err.Error()
+		account.Status.mu.Unlock()
+		account.stateChanged()
 		return
 	}
 
-	fmt.Println("Connected!")
-	fmt.Println(fmt.Sprintf("WebDAV server available at http://%s", OptListen))
+	filesystem := newProtonFS(account, session)
 
-	webdavServer = &http.Server{
-		Addr: OptListen,
-		Handler: &webdav.Handler{
-		FileSystem: &ProtonFS{session: session},
-		LockSystem: webdav.NewMemLS(),
-		},
+	account.connect(session, filesystem, newWebDAVHandler(account, filesystem), cancel)
+	serveWebDAV()
+
+	account.Status.mu.Lock()
+	account.Status.State = StateConnected
+	account.Status.mu.Unlock()
+	account.stateChanged()
+
+	go keepTokensFresh(ctx, account, session.Client())
+	go keepSessionAlive(ctx, account, session)
+	go filesystem.sweepTrash(ctx, account)
+	go filesystem.prewarm(ctx, account)
+
+	account.Log().Info("Connected to Proton Drive", "url", serverURLs(OptTLSCert, OptListen, account.Prefix()))
+}
+
+// serveWebDAV starts the WebDAV server unless it is already running
+func serveWebDAV() {
+	webdavMutex.Lock()
+	defer webdavMutex.Unlock()
+	defer updateWebDAVStatus()
+
+	if webdavServer != nil {
+		return
+	}
+
+	// Open all listeners first, so a failing address doesn't leave the
+	// server reachable on only some of them
+	var listeners []net.Listener
+	for _, addr := range OptListen {
+		listener, err := listen(addr)
+		if err != nil {
+			slog.Error("WebDAV server error", "address", addr, "error", err)
+
+			for _, listener := range listeners {
+				listener.Close()
+			}
+
+			return
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	webdavServer = newHTTPServer("", newWebDAVRouter())
+	webdavServer.DisableGeneralOptionsHandler = true
+
+	err := configureClientCerts(webdavServer)
+	if err == nil {
+		err = configureHTTP2(webdavServer, OptTLSCert)
+	}
+	if err != nil {
+		slog.Error("WebDAV server error", "error", err)
+
+		for _, listener := range listeners {
+			listener.Close()
+		}
+
+		webdavServer = nil
+		return
 	}
 	
-	// Start the server in a goroutine
-	go func() {
-		err := webdavServer.ListenAndServe()
-		if err != http.ErrServerClosed {
-			fmt.Printf("WebDAV server error: %v\n", err)
+	// Serve every listener in its own goroutine
+	webdavRunning.Store(true)
+	webdavAddresses = nil
+	for _, listener := range listeners {
+		webdavAddresses = append(webdavAddresses, listener.Addr().String())
+
+		go func(server *http.Server, listener net.Listener) {
+			err := serveListener(server, listener, OptTLSCert, OptTLSKey)
+			if err != http.ErrServerClosed {
+				slog.Error("WebDAV server error", "address", listener.Addr().String(), "error", err)
+
+				webdavMutex.Lock()
+				webdavRunning.Store(false)
+				updateWebDAVStatus()
+				webdavMutex.Unlock()
+			}
+		}(webdavServer, listener)
+	}
+}
+
+// updateWebDAVStatus stores whether the WebDAV server is serving each
+// account in its status. The caller must hold webdavMutex.
+func updateWebDAVStatus() {
+	running := webdavServer != nil && webdavRunning.Load()
+
+	for _, account := range accounts {
+		serving := running && account.Handler() != nil
+
+		account.Status.mu.Lock()
+		account.Status.WebDAVRunning = serving
+		account.Status.WebDAVAddresses = nil
+		if serving {
+			account.Status.WebDAVAddresses = webdavAddresses
 		}
-	}()
+		account.Status.mu.Unlock()
+	}
+}
+
+// newWebDAVHandler builds the WebDAV handler for the session of an account
+func newWebDAVHandler(account *Account, filesystem *ProtonFS) http.Handler {
+	locks := newConditionalLS(filesystem, newLockSystem(account))
+
+	var handler http.Handler = &webdav.Handler{
+		Prefix:     account.Prefix(),
+		FileSystem: filesystem,
+		LockSystem: locks,
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				account.Log().Debug("WebDAV request failed", "method", r.Method, "path", r.URL.Path, "remote", clientIP(r), "error", err)
+			}
+		},
+	}
+
+	handler = withQuotaProps(account.Prefix(), handler)
+	handler = withParallelCopy(filesystem, locks, account.Prefix(), handler)
+	handler = withMove(filesystem, account.Prefix(), handler)
+	handler = withConditionalGet(filesystem, account.Prefix(), handler)
+	handler = withRootGuard(account.Prefix(), handler)
+	handler = withAccessRules(filesystem, account.Prefix(), handler)
+	handler = withReadOnlyView(account, filesystem, handler)
+
+	return handler
+}
+
+// newWebDAVRouter builds the handler of the WebDAV server, including all
+// middleware shared by the accounts
+func newWebDAVRouter() http.Handler {
+	handler := newAccountRouter()
+	handler = withWebDAVPrefix(handler)
+	handler = withDestination(handler)
+	handler = withWindowsCompat(handler)
+	handler = withOptions(handler)
+
+	handler = withContentSniffing(handler)
+	handler = withDownloadAbort(handler)
+	handler = withUploadDigest(handler)
+	handler = withUploadLimit(handler)
+	handler = withBandwidthLimit(handler)
+	handler = withReadOnly(handler)
+	handler = withConcurrencyLimit(handler)
+	handler = withWebDAVAuth(handler)
+	handler = withMetrics(handler)
+	handler = withAccessLog(handler)
+
+	return handler
+}
+
+// describeSessionError turns session initialization errors into an actionable message
+func describeSessionError(err error) string {
+	if errors.Is(err, drive.ErrMainVolumeNotFound) {
+		return "Proton Drive is not set up for this account yet. Open https://drive.proton.me once to initialize it, then log in again."
+	}
+
+	return err.Error()
 }
 
-// stopWebDAVServer gracefully stops the WebDAV server
-func stopWebDAVServer() {
-	if webdavServer == nil {
+// stopWebDAVServer stops serving an account, and gracefully stops the WebDAV
+// server once no account is left to serve
+func stopWebDAVServer(account *Account) {
+	// draining the account and stopping the server share the timeout
+	deadline := time.Now().Add(OptShutdownTimeout)
+
+	if !account.disconnect(deadline) {
 		return
 	}
-	
-	fmt.Println("Stopping WebDAV server...")
-	
-	// Cancel the context to stop any ongoing operations
-	if webdavCancel != nil {
-		webdavCancel()
+
+	account.Log().Info("Disconnected from Proton Drive")
+
+	webdavMutex.Lock()
+	defer webdavMutex.Unlock()
+	defer updateWebDAVStatus()
+
+	if webdavServer == nil || anyAccountConnected() {
+		return
 	}
 	
-	// Create a shutdown context with a timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	slog.Info("Stopping WebDAV server")
+	
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
 	defer cancel()
 	
 	err := webdavServer.Shutdown(ctx)
 	if err != nil {
-		fmt.Printf("Error shutting down WebDAV server: %v\n", err)
+		slog.Error("Error shutting down WebDAV server", "error", err)
 	}
 	
 	webdavServer = nil
-	fmt.Println("WebDAV server stopped.")
+	webdavRunning.Store(false)
+	slog.Info("WebDAV server stopped")
 }
 
-// waitForever blocks indefinitely, keeping the main goroutine alive
-func waitForever() {
-	select {} // This will block forever
+func startAdminServer() {
+	// Forget failed admin login attempts once their window has passed
+	go loginLimiter.prune()
+
+	handler, err := newAdminHandler()
+	if err != nil {
+		slog.Error("Error setting up static file server", "error", err)
+		return
+	}
+
+	server := newHTTPServer(OptAdminListen, handler)
+
+	adminServerMutex.Lock()
+	adminServer = server
+	adminServerMutex.Unlock()
+
+	slog.Info("Admin interface available", "url", serverURL(OptAdminTLSCert, OptAdminListen, OptAdminPrefix+"/"))
+	err = serveHTTP(server, OptAdminTLSCert, OptAdminTLSKey)
+	if err != nil && err != http.ErrServerClosed {
+		slog.Error("Admin server error", "error", err)
+	}
 }
 
-func startAdminServer() {
+// newAdminHandler builds the handler of the admin interface, serving the
+// API and the web UI under -admin-prefix
+func newAdminHandler() (http.Handler, error) {
 	mux := http.NewServeMux()
-	
+
 	// Protected API endpoints
 	mux.HandleFunc("/api/status", withAdminAuth(handleStatus))
 	mux.HandleFunc("/api/login", withAdminAuth(handleLogin))
+	mux.HandleFunc("/api/login/tokens", withAdminAuth(handleLoginTokens))
 	mux.HandleFunc("/api/logout", withAdminAuth(handleLogout))
+	mux.HandleFunc("/api/restart-webdav", withAdminAuth(handleRestartWebDAV))
+	mux.HandleFunc("/api/refresh-tokens", withAdminAuth(handleRefreshTokens))
+	mux.HandleFunc("/api/info", withAdminAuth(handleInfo))
+	mux.HandleFunc("/api/setup-state", withSetupAccess(handleSetupState))
+	mux.HandleFunc("/api/cache", withAdminAuth(handleCacheStats))
+	mux.HandleFunc("/api/cache/flush", withAdminAuth(handleCacheFlush))
+	mux.HandleFunc("/api/canary", withAdminAuth(handleCanaryStatus))
+	mux.HandleFunc("/api/canary/reset", withAdminAuth(handleCanaryReset))
+	mux.HandleFunc("/api/quota", withAdminAuth(handleQuota))
+	mux.HandleFunc("/api/browse", withAdminAuth(handleBrowse))
+	mux.HandleFunc("/api/accounts", withAdminAuth(handleAccounts))
+	mux.HandleFunc("/api/tokens", withAdminAuth(handleAccessTokens))
+	mux.HandleFunc("/api/tokens/revoke", withAdminAuth(handleAccessTokenRevoke))
 	
 	// Admin auth endpoints
 	mux.HandleFunc("/api/admin/status", handleAdminStatus)
 	mux.HandleFunc("/api/admin/setup", handleAdminSetup)
 	mux.HandleFunc("/api/admin/login", handleAdminLogin)
 	mux.HandleFunc("/api/admin/logout", handleAdminLogout)
+	mux.HandleFunc("/api/admin/change-password", withAdminAuth(handleAdminChangePassword))
+	mux.HandleFunc("/api/admin/sessions", withAdminAuth(handleAdminSessions))
+	mux.HandleFunc("/api/admin/logs", withAdminAuth(handleAdminLogs))
+	
+	// Prometheus metrics, scraped without an admin session
+	mux.Handle("/metrics", handleMetrics)
+	
+	// Health checks for container orchestration
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
 	
 	// Serve static files
 	sub, err := fs.Sub(staticFiles, "static")
 	if err != nil {
-		fmt.Println("Error setting up static file server:", err)
-		return
-	}
-	fileServer := http.FileServer(http.FS(sub))
-	mux.Handle("/", fileServer)
-	
-	fmt.Printf("Admin interface available at http://%s\n", OptAdminListen)
-	err = http.ListenAndServe(OptAdminListen, mux)
-	if err != nil {
-		fmt.Printf("Admin server error: %v\n", err)
+		return nil, err
 	}
+	mux.Handle("/", withBaseHref(http.FileServer(http.FS(sub)), sub))
+
+	return withCORS(withAdminPrefix(mux)), nil
+}
+
+// setSessionCookie sets (or clears, if token is empty) the admin session cookie
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "admin_session",
+		Value:    token,
+		Path:     OptAdminPrefix + "/",
+		Domain:   OptAdminCookieDomain,
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   cookieSecure(r),
+		SameSite: cookieSameSiteModes[OptAdminCookieSameSite],
+	})
 }
 
 // withAdminAuth wraps a handler with admin authentication
 func withAdminAuth(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// If not initialized yet, allow access
+		// Until the admin password is set, only the status and setup
+		// endpoints are reachable
 		adminAuth.mu.Lock()
 		initialized := adminAuth.initialized
 		adminAuth.mu.Unlock()
 		
 		if !initialized {
-			handler(w, r)
+			http.Error(w, "Admin interface not set up", http.StatusUnauthorized)
 			return
 		}
 		
@@ -529,16 +803,29 @@ func withAdminAuth(handler http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		
-		// Validate session
+		// Validate session and slide its expiry forward
+		now := time.Now()
+
 		adminAuth.mu.Lock()
-		expiry, exists := adminAuth.sessions[cookie.Value]
+		session, exists := adminAuth.sessions[cookie.Value]
+		if exists && now.After(session.expires) {
+			delete(adminAuth.sessions, cookie.Value)
+			exists = false
+		}
+		var expiry time.Time
+		if exists {
+			session.extend(now)
+			expiry = session.expires
+		}
 		adminAuth.mu.Unlock()
 		
-		if !exists || time.Now().After(expiry) {
+		if !exists {
 			http.Error(w, "Session expired", http.StatusUnauthorized)
 			return
 		}
 		
+		setSessionCookie(w, r, cookie.Value, expiry)
+		
 		// Session valid, execute handler
 		handler(w, r)
 	}
@@ -567,12 +854,17 @@ func handleAdminSetup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if !checkLoginLimit(w, r) {
+		return
+	}
+	
 	// Check if already initialized
 	adminAuth.mu.Lock()
 	initialized := adminAuth.initialized
 	adminAuth.mu.Unlock()
 	
 	if initialized {
+		audit(r, AuditEvent{Event: AuditAdminSetup, Reason: "already_initialized"})
 		http.Error(w, "Admin already initialized", http.StatusBadRequest)
 		return
 	}
@@ -584,38 +876,44 @@ func handleAdminSetup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if !checkSetupToken(req.SetupToken) {
+		audit(r, AuditEvent{Event: AuditAdminSetup, Reason: "invalid_setup_token"})
+		http.Error(w, "Invalid setup token, it is printed on stderr at startup", http.StatusForbidden)
+		return
+	}
+	
 	// Validate password
 	if len(req.Password) < 8 {
+		audit(r, AuditEvent{Event: AuditAdminSetup, Reason: "password_too_short"})
 		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
 		return
 	}
 	
-	// Generate salt
-	salt, err := generateSalt()
+	// Hash password
+	passwordHash, err := hashPassword(req.Password)
 	if err != nil {
-		http.Error(w, "Error generating salt", http.StatusInternalServerError)
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
 		return
 	}
 	
-	// Hash password
-	passwordHash := hashPassword(req.Password, salt)
-	
 	// Store password data
 	data := AdminPasswordData{
 		PasswordHash: passwordHash,
-		Salt:         salt,
 	}
 	
 	if err := storeAdminPassword(data); err != nil {
 		http.Error(w, "Error storing password", http.StatusInternalServerError)
 		return
 	}
+	loginLimiter.Reset(clientIP(r))
+	audit(r, AuditEvent{Event: AuditAdminSetup, Success: true})
 	
 	// Update in-memory state
 	adminAuth.mu.Lock()
 	adminAuth.passwordHash = passwordHash
-	adminAuth.salt = salt
+	adminAuth.salt = ""
 	adminAuth.initialized = true
+	adminAuth.setupToken = ""
 	adminAuth.mu.Unlock()
 	
 	// Generate session token
@@ -626,20 +924,12 @@ func handleAdminSetup(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Store session
-	expiry := time.Now().Add(24 * time.Hour)
 	adminAuth.mu.Lock()
-	adminAuth.sessions[token] = expiry
+	expiry := newAdminSession(token, clientIP(r))
 	adminAuth.mu.Unlock()
 	
 	// Set session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "admin_session",
-		Value:    token,
-		Path:     "/",
-		Expires:  expiry,
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-	})
+	setSessionCookie(w, r, token, expiry)
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -652,6 +942,10 @@ func handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if !checkLoginLimit(w, r) {
+		return
+	}
+	
 	// Check if initialized
 	adminAuth.mu.Lock()
 	initialized := adminAuth.initialized
@@ -672,10 +966,18 @@ func handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Validate password
-	if hashPassword(req.Password, salt) != passwordHash {
+	if !verifyPassword(req.Password, passwordHash, salt) {
+		audit(r, AuditEvent{Event: AuditAdminLogin, Reason: "invalid_password"})
 		http.Error(w, "Invalid password", http.StatusUnauthorized)
 		return
 	}
+	loginLimiter.Reset(clientIP(r))
+	audit(r, AuditEvent{Event: AuditAdminLogin, Success: true})
+	
+	// Transparently upgrade hashes created by older versions
+	if isLegacyHash(passwordHash) {
+		upgradeAdminPassword(req.Password)
+	}
 	
 	// Generate session token
 	token, err := generateSessionToken()
@@ -685,20 +987,84 @@ func handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Store session
-	expiry := time.Now().Add(24 * time.Hour)
 	adminAuth.mu.Lock()
-	adminAuth.sessions[token] = expiry
+	expiry := newAdminSession(token, clientIP(r))
 	adminAuth.mu.Unlock()
 	
 	// Set session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "admin_session",
-		Value:    token,
-		Path:     "/",
-		Expires:  expiry,
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-	})
+	setSessionCookie(w, r, token, expiry)
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func handleAdminChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	
+	if !checkLoginLimit(w, r) {
+		return
+	}
+	
+	adminAuth.mu.Lock()
+	initialized := adminAuth.initialized
+	passwordHash := adminAuth.passwordHash
+	salt := adminAuth.salt
+	adminAuth.mu.Unlock()
+	
+	if !initialized {
+		http.Error(w, "Admin not initialized", http.StatusBadRequest)
+		return
+	}
+	
+	// Parse request
+	var req adminChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	
+	// Validate the current password
+	if !verifyPassword(req.CurrentPassword, passwordHash, salt) {
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+	loginLimiter.Reset(clientIP(r))
+	
+	// Validate the new password
+	if len(req.NewPassword) < 8 {
+		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+	
+	newHash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+	
+	if err := storeAdminPassword(AdminPasswordData{PasswordHash: newHash}); err != nil {
+		http.Error(w, "Error storing password", http.StatusInternalServerError)
+		return
+	}
+	
+	// Update in-memory state and end all other sessions
+	cookie, err := r.Cookie("admin_session")
+	
+	adminAuth.mu.Lock()
+	adminAuth.passwordHash = newHash
+	adminAuth.salt = ""
+	for token := range adminAuth.sessions {
+		if err != nil || token != cookie.Value {
+			delete(adminAuth.sessions, token)
+		}
+	}
+	adminAuth.mu.Unlock()
+	
+	slog.Info("Admin password changed", "remote", clientIP(r))
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -712,14 +1078,7 @@ func handleAdminLogout(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Clear session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "admin_session",
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-	})
+	setSessionCookie(w, r, "", time.Unix(0, 0))
 	
 	// Remove session from memory if it exists
 	cookie, err := r.Cookie("admin_session")
@@ -735,12 +1094,19 @@ func handleAdminLogout(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+	
 	w.Header().Set("Content-Type", "application/json")
 	
-	authStatus.mu.Lock()
-	defer authStatus.mu.Unlock()
+	account.Status.mu.Lock()
+	defer account.Status.mu.Unlock()
 	
-	err := json.NewEncoder(w).Encode(authStatus)
+	account.Status.ReadOnly = OptReadOnly
+	
+	err := json.NewEncoder(w).Encode(account.Status)
 	if err != nil {
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 	}
@@ -752,13 +1118,26 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+	
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 	
-	err := loginWithCredentials(req.Username, req.Password, req.MailboxPassword, req.TwoFA)
+	err := loginWithCredentials(account, req.Username, req.Password, req.MailboxPassword, req.TwoFA)
+	if err != nil {
+		account.Log().Warn("Login failed", "remote", clientIP(r), "error", err)
+	}
+	auditProtonLogin(r, account, req.Username, err)
+	if errors.Is(err, ErrUsernameEmpty) || errors.Is(err, ErrPasswordEmpty) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -775,43 +1154,90 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Stop WebDAV server
-	webdavMutex.Lock()
-	if webdavServer != nil {
-		stopWebDAVServer()
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
 	}
-	webdavMutex.Unlock()
+	
+	// Stop serving the account
+	stopWebDAVServer(account)
 	
 	// Delete tokens file
-	file, err := xdg.DataFile(TokenFile)
+	file, err := dataFile(account.TokenFile())
 	if err == nil {
 		os.Remove(file)
 	}
 	
-	authStatus.mu.Lock()
-	authStatus.LoggedIn = false
-	authStatus.NeedsLogin = true
-	authStatus.Error = ""
-	authStatus.mu.Unlock()
+	account.Status.mu.Lock()
+	account.Status.State = StateLoggedOut
+	account.Status.LoggedIn = false
+	account.Status.NeedsLogin = true
+	account.Status.Error = ""
+	account.Status.ErrorCode = ""
+	account.Status.Needs2FA = false
+	account.Status.mu.Unlock()
+	account.stateChanged()
 	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
-func loadTokens() (drive.Tokens, error) {
+// loadTokens reads the stored tokens of an account. If the token file is
+// damaged, the newest backup that can be read is restored instead.
+func loadTokens(account *Account) (drive.Tokens, error) {
 	var tokens drive.Tokens
 
-	file, err := xdg.DataFile(TokenFile)
+	file, err := dataFile(account.TokenFile())
 	if err != nil {
 		return tokens, err
 	}
 
+	tokens, err = readTokenFile(file)
+	if err == nil || os.IsNotExist(err) {
+		return tokens, err
+	}
+
+	tokensMutex.Lock()
+	defer tokensMutex.Unlock()
+
+	for i := 0; i < OptDataBackups; i++ {
+		backup := backupName(file, i)
+
+		restored, backupErr := readTokenFile(backup)
+		if backupErr != nil {
+			continue
+		}
+
+		account.Log().Warn("Token file is damaged, using backup", "file", file, "backup", backup, "error", err)
+
+		// otherwise, the next write would rotate the damaged file over the backup
+		data, _ := os.ReadFile(backup)
+		restoreErr := replaceFile(file, data, false)
+		if restoreErr != nil {
+			account.Log().Error("Error restoring token file from backup", "file", file, "error", restoreErr)
+		}
+
+		return restored, nil
+	}
+
+	return tokens, err
+}
+
+// readTokenFile reads and decrypts a token file
+func readTokenFile(file string) (drive.Tokens, error) {
+	var tokens drive.Tokens
+
 	enc, err := os.ReadFile(file)
 	if err != nil {
 		return tokens, err
 	}
 
+	enc, err = decryptTokens(enc)
+	if err != nil {
+		return tokens, err
+	}
+
 	err = json.Unmarshal(enc, &tokens)
 	if err != nil {
 		return tokens, err
@@ -820,36 +1246,225 @@ func loadTokens() (drive.Tokens, error) {
 	return tokens, nil
 }
 
-func storeTokens(tokens drive.Tokens) error {
-	file, err := xdg.DataFile(TokenFile)
+func storeTokens(account *Account, tokens drive.Tokens) error {
+	tokensMutex.Lock()
+	defer tokensMutex.Unlock()
+
+	file, err := dataFile(account.TokenFile())
 	if err != nil {
+		setTokenWarning(account, err)
 		return err
 	}
 
-	// Ensure the directory exists
-	dir := filepath.Dir(file)
-	if err := os.MkdirAll(dir, 0700); err != nil {
+	enc, err := json.Marshal(tokens)
+	if err != nil {
 		return err
 	}
 
-	enc, err := json.Marshal(tokens)
+	enc, err = encryptTokens(enc)
+	if err != nil {
+		return err
+	}
+
+	err = writeDataFile(file, enc)
+	if err != nil {
+		account.Log().Warn("Error writing tokens, retrying", "file", file, "error", err)
+
+		time.Sleep(TokenWriteRetryDelay)
+		err = writeDataFile(file, enc)
+	}
+
+	setTokenWarning(account, err)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(file, enc, 0600)
+	tokensRefreshed.WithLabelValues(account.Name).SetToCurrentTime()
+	return nil
 }
 
 func main() {
 	var err error = nil
 
+	flag.StringVar(&OptConfig, "config", envOr("PROTON_CONFIG", OptConfig), "YAML file to load settings from")
 	flag.BoolVar(&OptLogin, "login", OptLogin, "Run Proton Drive login")
-	flag.StringVar(&OptListen, "listen", OptListen, "Which address the WebDAV server will listen to")
-	flag.StringVar(&OptAdminListen, "admin-listen", OptAdminListen, "Which address the admin interface will listen to")
+	flag.Var(newAddressList(&OptListen), "listen", "Which addresses the WebDAV server will listen to, can be repeated or comma-separated (or unix:/path/to/socket)")
+	flag.StringVar(&OptAccounts, "accounts", envOr("PROTON_ACCOUNTS", OptAccounts), "Comma separated names of the accounts to serve under /<name>/")
+	flag.BoolVar(&OptCheckLogin, "check-login", OptCheckLogin, "Test the Proton Drive credentials from the environment and exit")
+	flag.StringVar(&OptAccount, "account", OptAccount, "Which account to login with -login or -check-login")
+	flag.StringVar(&OptAdminListen, "admin-listen", OptAdminListen, "Which address the admin interface will listen to (or unix:/path/to/socket)")
+	flag.BoolVar(&OptNoAdmin, "no-admin", envBool("PROTON_NO_ADMIN", OptNoAdmin), "Don't start the admin interface, log in with environment variables only")
+	flag.StringVar(&OptReadOnlySubpath, "listen-webdav-readonly-subpath", envOr("PROTON_READONLY_SUBPATH", OptReadOnlySubpath), "URL path under which a read-only view of the drive is served next to the read-write one (e.g. /ro)")
+	flag.BoolVar(&OptReadOnly, "read-only", envBool("PROTON_READ_ONLY", OptReadOnly), "Reject all WebDAV requests that would modify the drive")
+	flag.StringVar(&OptWebDAVUser, "webdav-user", envOr("PROTON_WEBDAV_USER", OptWebDAVUser), "Username WebDAV clients must authenticate with")
+	flag.BoolVar(&OptAllowInsecure, "allow-insecure", envBool("PROTON_ALLOW_INSECURE", OptAllowInsecure), "Serve WebDAV without authentication on addresses other machines can reach")
+	flag.StringVar(&OptWebDAVPass, "webdav-pass", envOr("PROTON_WEBDAV_PASS", OptWebDAVPass), "Password WebDAV clients must authenticate with")
+	flag.DurationVar(&OptReadTimeout, "read-timeout", OptReadTimeout, "Maximum duration for reading a whole request, including uploads (0 disables)")
+	flag.DurationVar(&OptWriteTimeout, "write-timeout", OptWriteTimeout, "Maximum duration for writing a whole response, including downloads (0 disables)")
+	flag.DurationVar(&OptIdleTimeout, "idle-timeout", OptIdleTimeout, "How long idle keep-alive connections stay open (0 disables)")
+	flag.DurationVar(&OptShutdownTimeout, "shutdown-timeout", OptShutdownTimeout, "How long to wait for in-flight requests when shutting down")
+	flag.IntVar(&OptLoginAttempts, "admin-login-attempts", OptLoginAttempts, "Failed admin logins per client before it is blocked (0 disables)")
+	flag.DurationVar(&OptLoginWindow, "admin-login-window", OptLoginWindow, "Window over which failed admin logins are counted")
+	flag.DurationVar(&OptAdminSessionTTL, "admin-session-ttl", OptAdminSessionTTL, "How long an admin session stays valid without being used")
+	flag.DurationVar(&OptAdminSessionMaxLifetime, "admin-session-max-lifetime", OptAdminSessionMaxLifetime, "How long an admin session stays valid at most, no matter how it is used (0 disables)")
+	flag.IntVar(&OptBcryptCost, "bcrypt-cost", OptBcryptCost, "bcrypt cost used for hashing passwords")
+	flag.StringVar(&OptTLSCert, "tls-cert", envOr("PROTON_TLS_CERT", OptTLSCert), "TLS certificate file for the WebDAV server")
+	flag.StringVar(&OptTLSKey, "tls-key", envOr("PROTON_TLS_KEY", OptTLSKey), "TLS private key file for the WebDAV server")
+	flag.StringVar(&OptTLSClientCA, "tls-client-ca", envOr("PROTON_TLS_CLIENT_CA", OptTLSClientCA), "CA certificate file; WebDAV clients must present a certificate signed by it instead of a password")
+	flag.StringVar(&OptTLSClientAccess, "tls-client-access", envOr("PROTON_TLS_CLIENT_ACCESS", OptTLSClientAccess), "Permissions of client certificates by common name, e.g. laptop=read-write,tv=read-only")
+	flag.BoolVar(&OptHTTP1Only, "http1-only", envBool("PROTON_HTTP1_ONLY", OptHTTP1Only), "Serve WebDAV over HTTP/1.1 only, for clients that break with HTTP/2")
+	flag.BoolVar(&OptH2C, "h2c", envBool("PROTON_H2C", OptH2C), "Also serve WebDAV over cleartext HTTP/2 when TLS is not used")
+	flag.StringVar(&OptAdminTLSCert, "admin-tls-cert", envOr("PROTON_ADMIN_TLS_CERT", OptAdminTLSCert), "TLS certificate file for the admin interface")
+	flag.StringVar(&OptAdminTLSKey, "admin-tls-key", envOr("PROTON_ADMIN_TLS_KEY", OptAdminTLSKey), "TLS private key file for the admin interface")
+	flag.StringVar(&OptAdminSetupToken, "admin-setup-token", envOr("PROTON_ADMIN_SETUP_TOKEN", OptAdminSetupToken), "Token needed to set the admin password on first run (default: a random token printed to stderr on startup)")
+	flag.StringVar(&OptAdminCookieSameSite, "admin-cookie-samesite", OptAdminCookieSameSite, "SameSite attribute of the admin session cookie (strict, lax or none)")
+	flag.StringVar(&OptAdminCookieSecure, "admin-cookie-secure", OptAdminCookieSecure, "Whether the admin session cookie is marked Secure (auto sets it for HTTPS requests, or true or false)")
+	flag.StringVar(&OptAdminCookieDomain, "admin-cookie-domain", OptAdminCookieDomain, "Domain attribute of the admin session cookie, to share it with subdomains (default: the host only)")
+	flag.StringVar(&OptAdminCORSOrigin, "admin-cors-origin", OptAdminCORSOrigin, "Origin allowed to use the admin API from a browser (or * for any origin, without credentials)")
+	flag.StringVar(&OptTrustedProxies, "trusted-proxies", envOr("PROTON_TRUSTED_PROXIES", OptTrustedProxies), "Comma-separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For and X-Forwarded-Proto headers are trusted")
+	flag.StringVar(&OptAdminPrefix, "admin-prefix", OptAdminPrefix, "URL path prefix the admin interface is served under (e.g. /admin)")
+	flag.StringVar(&OptAccessRules, "access-rules", envOr("PROTON_ACCESS_RULES", OptAccessRules), "YAML file with rules that make paths in the drive hidden or read-only")
+	flag.StringVar(&OptRootPath, "root-path", envOr("PROTON_ROOT_PATH", OptRootPath), "Folder in the drive that is served as the root of the WebDAV share (default: the whole drive)")
+	flag.StringVar(&OptWebDAVPrefix, "webdav-prefix", envOr("PROTON_WEBDAV_PREFIX", OptWebDAVPrefix), "URL path prefix the WebDAV server is served under (e.g. /dav)")
+	flag.DurationVar(&OptNetworkTimeout, "network-timeout", OptNetworkTimeout, "How long to wait for Proton Drive to become reachable before connecting fails (0 waits forever)")
+	flag.IntVar(&OptConnectRetries, "connect-retries", OptConnectRetries, "How often connecting to Proton Drive is retried on network errors (-1 retries forever)")
+	flag.DurationVar(&OptConnectRetryMaxDelay, "connect-retry-max-delay", OptConnectRetryMaxDelay, "Longest delay between two attempts to connect to Proton Drive")
+	flag.DurationVar(&OptTokenRefresh, "token-refresh", OptTokenRefresh, "How often to check the Proton tokens in the background, refreshing them if needed (0 disables)")
+	flag.DurationVar(&OptKeepAlive, "keep-alive", OptKeepAlive, "How often the drive is pinged while idle, so the session doesn't go stale (0 disables)")
+	flag.IntVar(&OptUploadReadAhead, "upload-read-ahead", OptUploadReadAhead, "How many 4 MiB blocks of an upload are read ahead while the previous block is uploading (0 disables)")
+	flag.Int64Var(&OptDownloadRateLimit, "download-rate-limit", OptDownloadRateLimit, "Bandwidth in bytes per second shared by all WebDAV downloads (0 disables)")
+	flag.Int64Var(&OptUploadRateLimit, "upload-rate-limit", OptUploadRateLimit, "Bandwidth in bytes per second shared by all WebDAV uploads (0 disables)")
+	flag.IntVar(&OptMaxConcurrentRequests, "max-concurrent-requests", OptMaxConcurrentRequests, "How many WebDAV requests are served at once, more are refused with 503 (0 disables)")
+	flag.Int64Var(&OptMaxUploadSize, "max-upload-size", OptMaxUploadSize, "Largest file in MiB that can be uploaded, bigger uploads are rejected (0 disables)")
+	flag.IntVar(&OptUploadRetries, "upload-retries", OptUploadRetries, "How often a failed upload of a file block is retried")
+	flag.DurationVar(&OptUploadRetryBaseDelay, "upload-retry-base-delay", OptUploadRetryBaseDelay, "Delay before the first upload retry, doubled for every further retry")
+	flag.BoolVar(&OptTrashEnabled, "trash-enabled", envBool("PROTON_TRASH_ENABLED", OptTrashEnabled), "Move deleted files to a trash folder in the drive instead of deleting them")
+	flag.StringVar(&OptTrashDir, "trash-dir", OptTrashDir, "Folder in the drive deleted files are moved to with -trash-enabled")
+	flag.DurationVar(&OptTrashRetention, "trash-retention", OptTrashRetention, "How long files stay in the trash before they are deleted (0 keeps them forever)")
+	flag.StringVar(&OptLockStore, "lock-store", OptLockStore, "Where WebDAV locks are kept (memory, or file to keep them across restarts)")
+	flag.DurationVar(&OptCacheTTL, "cache-ttl", OptCacheTTL, "How long file metadata is cached (0 disables caching)")
+	flag.BoolVar(&OptPrewarm, "prewarm", envBool("PROTON_PREWARM", OptPrewarm), "List the folders of the drive in the background after connecting, to fill the metadata cache")
+	flag.IntVar(&OptPrewarmDepth, "prewarm-depth", OptPrewarmDepth, "How many levels of folders -prewarm lists (0 lists the whole drive)")
+	flag.IntVar(&OptRecursiveWorkers, "recursive-workers", OptRecursiveWorkers, "How many files recursive operations like COPY process in parallel, across all requests")
+	flag.StringVar(&OptBackupDir, "backup-dir", OptBackupDir, "Directory the token and admin password files are periodically copied to")
+	flag.StringVar(&OptBackupCommand, "backup-command", OptBackupCommand, "Shell command run periodically to back up the state files (listed in $PROTON_BACKUP_FILES)")
+	flag.DurationVar(&OptBackupInterval, "backup-interval", OptBackupInterval, "How often the state files are backed up")
+	flag.StringVar(&OptDataDir, "data-dir", envOr("PROTON_DATA_DIR", OptDataDir), "Directory the tokens and admin password are stored in (default $XDG_DATA_HOME/proton-webdav-bridge)")
+	flag.StringVar(&OptDataFileMode, "data-file-mode", OptDataFileMode, "Permissions of the token, admin password and other data files")
+	flag.StringVar(&OptDataDirMode, "data-dir-mode", OptDataDirMode, "Permissions of the data directory")
+	flag.IntVar(&OptDataBackups, "data-backups", OptDataBackups, "How many backups of the token and admin password files to keep")
+	flag.StringVar(&OptDownloadFailure, "download-failure", OptDownloadFailure, "What to do when a file breaks off mid-download (abort or truncate)")
+	flag.Float64Var(&OptCanaryDeletes, "canary-deletes", OptCanaryDeletes, "Deletes per second that trip write protection (0 disables)")
+	flag.Float64Var(&OptCanaryOverwrites, "canary-overwrites", OptCanaryOverwrites, "Overwrites per second that trip write protection (0 disables)")
+	flag.DurationVar(&OptCanaryWindow, "canary-window", OptCanaryWindow, "Time window over which the canary rates are measured")
+	flag.StringVar(&OptNotifyURL, "notify-url", envOr("PROTON_NOTIFY_URL", OptNotifyURL), "URL that is notified with a JSON POST when an account is connected, logged out, its tokens expire or it fails")
+	flag.StringVar(&OptCanaryWebhook, "canary-webhook", OptCanaryWebhook, "URL that is notified when write protection trips")
+	flag.Int64Var(&OptContentCacheSize, "content-cache-size", OptContentCacheSize, "Maximum size of the on-disk cache for file contents in MiB (0 disables)")
+	flag.StringVar(&OptContentCacheDir, "content-cache-dir", OptContentCacheDir, "Directory of the content cache (default $XDG_CACHE_HOME/proton-webdav-bridge/content)")
+	flag.BoolVar(&OptSniffContentType, "sniff-content-type", envBool("PROTON_SNIFF_CONTENT_TYPE", OptSniffContentType), "Read the start of files without a known type to detect their Content-Type on download")
+	flag.BoolVar(&OptWindowsCompat, "windows-compat", envBool("PROTON_WINDOWS_COMPAT", OptWindowsCompat), "Apply the header quirks the WebDAV client of Windows Explorer needs")
+	flag.BoolVar(&OptFilterAppleDouble, "filter-apple-double", envBool("PROTON_FILTER_APPLE_DOUBLE", OptFilterAppleDouble), "Discard .DS_Store and ._* files written by macOS and hide them from listings")
+	flag.StringVar(&OptAuditLog, "audit-log", envOr("PROTON_AUDIT_LOG", OptAuditLog), "File that admin, Proton and WebDAV login attempts are appended to as JSON lines")
+	flag.Int64Var(&OptAuditLogMaxSize, "audit-log-max-size", OptAuditLogMaxSize, "Size in MiB at which the audit log is rotated, keeping one old file")
+	flag.BoolVar(&OptAccessLog, "access-log", envBool("PROTON_ACCESS_LOG", OptAccessLog), "Log every WebDAV request")
+	flag.StringVar(&OptLogFormat, "log-format", OptLogFormat, "Format of log messages (text or json)")
+	flag.StringVar(&OptLogLevel, "log-level", OptLogLevel, "Minimum level of log messages (debug, info, warn or error)")
+	flag.IntVar(&OptLogBuffer, "log-buffer", OptLogBuffer, "How many recent log messages are kept for /api/admin/logs (0 disables)")
+	flag.BoolVar(&OptVersion, "version", OptVersion, "Print the version of the bridge and exit")
+	flag.BoolVar(&OptPrintConfig, "print-config", OptPrintConfig, "Print the effective configuration as JSON, check it and exit")
 	flag.Parse()
 
+	if OptVersion {
+		printVersion()
+		os.Exit(0)
+	}
+
+	if OptConfig != "" {
+		err = loadConfig(OptConfig)
+		if err != nil {
+			fmt.Println("Invalid config:", err)
+			os.Exit(2)
+		}
+	}
+
+	OptAdminPrefix = normalizePrefix(OptAdminPrefix)
+	OptWebDAVPrefix = normalizePrefix(OptWebDAVPrefix)
+	OptReadOnlySubpath = normalizePrefix(OptReadOnlySubpath)
+	OptRootPath = normalizePrefix(OptRootPath)
+
+	if OptPrintConfig {
+		err = printConfig()
+		if err == nil {
+			err = validateOptions()
+		}
+		if err != nil {
+			fmt.Println("Invalid options:", err)
+			os.Exit(2)
+		}
+
+		os.Exit(0)
+	}
+
+	err = setupLogging()
+	if err == nil {
+		err = validateOptions()
+	}
+	if err == nil {
+		err = initAccounts()
+	}
+	if err == nil {
+		err = initTrustedProxies()
+	}
+	if err == nil {
+		err = initSecretOptions()
+	}
+	if err == nil {
+		err = initTokenEncryption()
+	}
+	if err == nil {
+		err = initDataDir()
+	}
+	if err == nil {
+		err = initAuditLog()
+	}
+	if err == nil {
+		err = initAccessRules()
+	}
+	if err == nil {
+		err = initAccessTokens()
+	}
+	if err == nil {
+		err = initClientCerts()
+	}
+	if err == nil {
+		err = checkInsecureListen()
+	}
+	if err != nil {
+		fmt.Println("Invalid options:", err)
+		os.Exit(2)
+	}
+
+	initUploadRetries()
+	initContentTypes()
+
+	if OptCheckLogin {
+		account := findAccount(OptAccount)
+		if account == nil {
+			fmt.Println("Invalid options: unknown account", OptAccount)
+			os.Exit(2)
+		}
+
+		os.Exit(doCheckLogin(account))
+	}
+
 	if OptLogin {
-		err = doLogin()
+		account := findAccount(OptAccount)
+		if account == nil {
+			fmt.Println("Invalid options: unknown account", OptAccount)
+			os.Exit(2)
+		}
+
+		err = doLogin(account)
 	} else {
 		err = doListen()
 	}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+func TestValidateCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{"valid", "me@proton.me", "hunter2", nil},
+		{"username with spaces around", "  me@proton.me\n", "hunter2", nil},
+		{"password with spaces around", "me@proton.me", " hunter2 ", nil},
+		{"empty username", "", "hunter2", ErrUsernameEmpty},
+		{"whitespace username", " \t\n", "hunter2", ErrUsernameEmpty},
+		{"empty password", "me@proton.me", "", ErrPasswordEmpty},
+		{"whitespace password", "me@proton.me", "   ", ErrPasswordEmpty},
+		{"both empty", "", "", ErrUsernameEmpty},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateCredentials(test.username, test.password)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("validateCredentials returned %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestHandleLoginRejectsEmptyCredentials(t *testing.T) {
+	saved := accounts
+	t.Cleanup(func() { accounts = saved })
+
+	for _, body := range []string{
+		`{"username": "", "password": "hunter2"}`,
+		`{"username": "   ", "password": "hunter2"}`,
+		`{"username": "me@proton.me", "password": ""}`,
+		`{"username": "me@proton.me", "password": " \t "}`,
+	} {
+		account := newAccount("")
+		accounts = []*Account{account}
+
+		w := httptest.NewRecorder()
+		handleLogin(w, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("login with %s returned %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+
+		if account.Status.ErrorCode != LoginErrorCredentials {
+			t.Errorf("login with %s set error code %q, want %q", body, account.Status.ErrorCode, LoginErrorCredentials)
+		}
+	}
+}
+
+func TestEmptyCredentialsNameAccountVariables(t *testing.T) {
+	tests := []struct {
+		account  string
+		username string
+		want     string
+	}{
+		{"", "", "PROTON_USERNAME"},
+		{"", "me@proton.me", "PROTON_PASSWORD"},
+		{"work-drive", "", "PROTON_WORK_DRIVE_USERNAME"},
+		{"work-drive", "me@proton.me", "PROTON_WORK_DRIVE_PASSWORD"},
+	}
+
+	for _, test := range tests {
+		mode := passwordLogin{credentials: drive.Credentials{Username: test.username}}
+
+		_, err := mode.Login(context.Background(), newAccount(test.account), nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("account %q with username %q: got %v, want a hint to set %s", test.account, test.username, err, test.want)
+		}
+	}
+}
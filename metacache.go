@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+var (
+	OptCacheTTL = 30 * time.Second
+)
+
+// metadataEntry holds what is known about a single path
+type metadataEntry struct {
+	info     os.FileInfo
+	children []os.FileInfo
+	listed   bool
+	expires  time.Time
+}
+
+// MetadataCache caches the results of Stat and directory listings by path,
+// so clients that issue lots of repeated PROPFINDs don't hit the API every
+// time. A nil *MetadataCache caches nothing.
+type MetadataCache struct {
+	name    string
+	ttl     time.Duration
+	entries map[string]*metadataEntry
+	hits    uint64
+	misses  uint64
+	mu      sync.Mutex
+}
+
+var _ Cache = &MetadataCache{}
+
+// NewMetadataCache creates a cache whose entries live for ttl. It returns
+// nil if ttl is not positive, which disables caching.
+func NewMetadataCache(name string, ttl time.Duration) *MetadataCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &MetadataCache{
+		name:    name,
+		ttl:     ttl,
+		entries: map[string]*metadataEntry{},
+	}
+}
+
+func (self *MetadataCache) get(name string) *metadataEntry {
+	entry, ok := self.entries[name]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(self.entries, name)
+		return nil
+	}
+
+	return entry
+}
+
+func (self *MetadataCache) put(name string) *metadataEntry {
+	entry := self.get(name)
+	if entry == nil {
+		entry = &metadataEntry{expires: time.Now().Add(self.ttl)}
+		self.entries[name] = entry
+	}
+
+	return entry
+}
+
+// Stat returns the cached file info of name
+func (self *MetadataCache) Stat(name string) (os.FileInfo, bool) {
+	if self == nil {
+		return nil, false
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	entry := self.get(path.Clean("/" + name))
+	if entry == nil || entry.info == nil {
+		self.misses++
+		return nil, false
+	}
+
+	self.hits++
+	return entry.info, true
+}
+
+// Readdir returns the cached info and children of the directory name
+func (self *MetadataCache) Readdir(name string) (os.FileInfo, []os.FileInfo, bool) {
+	if self == nil {
+		return nil, nil, false
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	entry := self.get(path.Clean("/" + name))
+	if entry == nil || !entry.listed {
+		self.misses++
+		return nil, nil, false
+	}
+
+	self.hits++
+	return entry.info, entry.children, true
+}
+
+// PutStat caches the file info of name
+func (self *MetadataCache) PutStat(name string, info os.FileInfo) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.put(path.Clean("/" + name)).info = info
+}
+
+// PutReaddir caches the info and children of the directory name, and the
+// info of each child
+func (self *MetadataCache) PutReaddir(name string, info os.FileInfo, children []os.FileInfo) {
+	if self == nil {
+		return
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	name = path.Clean("/" + name)
+
+	entry := self.put(name)
+	entry.info = info
+	entry.children = children
+	entry.listed = true
+
+	// a depth 1 PROPFIND stats every child right after listing the directory
+	for _, child := range children {
+		self.put(path.Join(name, child.Name())).info = child
+	}
+}
+
+// Invalidate drops name, its descendants and the listing of its parent
+func (self *MetadataCache) Invalidate(name string) {
+	if self == nil {
+		return
+	}
+
+	name = path.Clean("/" + name)
+	self.Flush(name)
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delete(self.entries, path.Dir(name))
+}
+
+func (self *MetadataCache) Stats() CacheStats {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return CacheStats{
+		Name:    self.name,
+		Entries: len(self.entries),
+		Hits:    self.hits,
+		Misses:  self.misses,
+	}
+}
+
+func (self *MetadataCache) Flush(prefix string) int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	flushed := 0
+	for name := range self.entries {
+		if pathHasPrefix(name, prefix) {
+			delete(self.entries, name)
+			flushed++
+		}
+	}
+
+	return flushed
+}
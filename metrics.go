@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The collectors are registered once when the process starts, and shared by
+// every WebDAV server that is started afterwards.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	webdavRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "proton_webdav_bridge_webdav_requests_total",
+		Help: "WebDAV requests by method and status code.",
+	}, []string{"method", "code"})
+
+	webdavRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "proton_webdav_bridge_webdav_request_duration_seconds",
+		Help:    "Latency of WebDAV requests by method.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"method"})
+
+	tokensRefreshed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "proton_webdav_bridge_tokens_refreshed_timestamp_seconds",
+		Help: "When the Proton tokens of an account were last issued or refreshed.",
+	}, []string{"account"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		webdavRequests,
+		webdavRequestDuration,
+		tokensRefreshed,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "proton_webdav_bridge_webdav_running",
+			Help: "Whether the WebDAV server is running.",
+		}, func() float64 {
+			if webdavRunning.Load() {
+				return 1
+			}
+
+			return 0
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "proton_webdav_bridge_admin_sessions",
+			Help: "Number of active admin sessions.",
+		}, func() float64 {
+			return float64(countAdminSessions())
+		}),
+	)
+}
+
+// countAdminSessions returns the number of admin sessions that have not expired
+func countAdminSessions() int {
+	adminAuth.mu.Lock()
+	defer adminAuth.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+
+	for _, session := range adminAuth.sessions {
+		if now.Before(session.expires) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// webdavMethods are the WebDAV verbs promhttp would otherwise count as
+// "unknown", since it only knows the standard HTTP methods
+var webdavMethods = promhttp.WithExtraMethods(
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+)
+
+// withMetrics records the count and latency of WebDAV requests
+func withMetrics(handler http.Handler) http.Handler {
+	handler = promhttp.InstrumentHandlerDuration(webdavRequestDuration, handler, webdavMethods)
+	handler = promhttp.InstrumentHandlerCounter(webdavRequests, handler, webdavMethods)
+
+	return handler
+}
+
+// handleMetrics serves the metrics in the Prometheus exposition format
+var handleMetrics = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
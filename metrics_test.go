@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCountWebDAVMethods(t *testing.T) {
+	handler := withMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+
+	counter := webdavRequests.WithLabelValues("propfind", "207")
+	before := testutil.ToFloat64(counter)
+
+	serveDAV(handler, "PROPFIND", "/", nil)
+
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("PROPFIND counted %v times under method=propfind, want 1", got)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/StollD/webdav"
+)
+
+// withMove checks MOVE requests before the WebDAV handler renames the
+// resource, which is a single move operation in Proton Drive, no matter if
+// the resource is renamed in place or moved to another folder.
+//
+// The handler only overwrites the destination if the Overwrite header is T,
+// while RFC 4918 makes T the default. A missing header is therefore set to T.
+func withMove(fs webdav.FileSystem, prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "MOVE" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Header.Get("Overwrite") {
+		case "":
+			r.Header.Set("Overwrite", "T")
+		case "T", "F":
+		default:
+			http.Error(w, "Invalid Overwrite header", http.StatusBadRequest)
+			return
+		}
+
+		src, ok := stripPrefix(r.URL.Path, prefix)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		dst, status := parseCopyDestination(r)
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		// moves between accounts are not supported
+		dst, ok = stripPrefix(dst, prefix)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+
+		// a collection can't be moved into itself
+		if dst != src && strings.HasPrefix(dst, strings.TrimSuffix(src, "/")+"/") {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		// the handler responds with 403 if the destination folder is
+		// missing, RFC 4918 asks for 409
+		parent, err := fs.Stat(r.Context(), path.Dir(dst))
+		if err != nil || !parent.IsDir() {
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/StollD/webdav"
+)
+
+// writeMemFile creates a file with content in a test filesystem
+func writeMemFile(t *testing.T, fs webdav.FileSystem, name, content string) {
+	t.Helper()
+
+	file, err := fs.OpenFile(context.Background(), name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = io.WriteString(file, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readMemFile returns the content of a file in a test filesystem
+func readMemFile(t *testing.T, fs webdav.FileSystem, name string) (string, bool) {
+	t.Helper()
+
+	file, err := fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		return "", false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content), true
+}
+
+// serveDAV sends a request with the given headers to handler
+func serveDAV(handler http.Handler, method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func newMoveTestHandler(t *testing.T) (http.Handler, webdav.FileSystem) {
+	t.Helper()
+
+	fs := webdav.NewMemFS()
+	ctx := context.Background()
+
+	for _, dir := range []string{"/a", "/a/sub", "/b"} {
+		err := fs.Mkdir(ctx, dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeMemFile(t, fs, "/a/file.txt", "hello")
+	writeMemFile(t, fs, "/b/taken.txt", "old")
+
+	var handler http.Handler = &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	handler = withMove(fs, "", handler)
+	handler = withDestination(handler)
+	return handler, fs
+}
+
+func TestMove(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         string
+		destination string
+		overwrite   string
+		status      int
+		moved       string
+	}{
+		{"into another folder", "/a/file.txt", "/b/file.txt", "", http.StatusCreated, "/b/file.txt"},
+		{"rename in place", "/a/file.txt", "/a/renamed.txt", "", http.StatusCreated, "/a/renamed.txt"},
+		{"full URL destination", "/a/file.txt", "http://example.com/b/file.txt", "", http.StatusCreated, "/b/file.txt"},
+		{"overwrite by default", "/a/file.txt", "/b/taken.txt", "", http.StatusNoContent, "/b/taken.txt"},
+		{"overwrite F on existing destination", "/a/file.txt", "/b/taken.txt", "F", http.StatusPreconditionFailed, ""},
+		{"invalid overwrite", "/a/file.txt", "/b/file.txt", "X", http.StatusBadRequest, ""},
+		{"missing parent", "/a/file.txt", "/missing/file.txt", "", http.StatusConflict, ""},
+		{"into itself", "/a", "/a/sub/a", "", http.StatusForbidden, ""},
+		{"other server", "/a/file.txt", "http://elsewhere.com/b/file.txt", "", http.StatusBadGateway, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler, fs := newMoveTestHandler(t)
+
+			headers := map[string]string{"Destination": test.destination}
+			if test.overwrite != "" {
+				headers["Overwrite"] = test.overwrite
+			}
+
+			w := serveDAV(handler, "MOVE", "http://example.com"+test.src, headers)
+			if w.Code != test.status {
+				t.Fatalf("MOVE returned %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+
+			_, srcExists := readMemFile(t, fs, "/a/file.txt")
+			if test.moved == "" {
+				if !srcExists {
+					t.Fatal("the source was removed by a failed move")
+				}
+
+				return
+			}
+
+			if srcExists {
+				t.Fatal("the source still exists after the move")
+			}
+
+			content, ok := readMemFile(t, fs, test.moved)
+			if !ok || content != "hello" {
+				t.Fatalf("%s contains %q (exists: %v), want %q", test.moved, content, ok, "hello")
+			}
+		})
+	}
+}
@@ -1,27 +1,86 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 )
 
 const (
 	TestUrl = "https://drive.proton.me"
+
+	NetworkCheckInterval = 10 * time.Second
+	NetworkCheckTimeout  = 10 * time.Second
 )
 
-func CheckNetwork() bool {
+var (
+	OptNetworkTimeout = 5 * time.Minute
+
+	ErrNetworkTimeout = errors.New("network is not reachable")
+)
+
+func CheckNetwork(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, NetworkCheckTimeout)
+	defer cancel()
+
 	client := http.Client{
 		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 
-	_, err := client.Head(TestUrl)
-	return err == nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, TestUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+	return nil
 }
 
-func WaitNetwork() {
-	for !CheckNetwork() {
-		time.Sleep(time.Second * 10)
+// WaitNetwork blocks until Proton Drive can be reached. It gives up once
+// -network-timeout has passed, or when ctx is canceled.
+func WaitNetwork(ctx context.Context, log *slog.Logger) error {
+	if OptNetworkTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, OptNetworkTimeout)
+		defer cancel()
+	}
+
+	var last error
+
+	for attempt := 1; ; attempt++ {
+		err := CheckNetwork(ctx)
+		if err == nil {
+			return nil
+		}
+
+		// a check that was cut short by the deadline says nothing new
+		if ctx.Err() == nil || last == nil {
+			last = err
+		}
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: could not reach %s within %s: %w", ErrNetworkTimeout, TestUrl, OptNetworkTimeout, last)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		log.Warn("Network is not reachable yet, retrying", "attempt", attempt, "retry_in", NetworkCheckInterval, "error", err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(NetworkCheckInterval):
+		}
 	}
 }
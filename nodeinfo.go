@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
 	"os"
 	"time"
@@ -20,7 +21,9 @@ type ProtonNodeInfo struct {
 	size     int64
 	isDir    bool
 	modTime  time.Time
+	created  time.Time
 	hash     string
+	revision string
 	mimeType string
 }
 
@@ -30,7 +33,9 @@ func NewNodeInfo(link *drive.Link) *ProtonNodeInfo {
 		size:     link.Size(),
 		isDir:    link.IsDir(),
 		modTime:  link.ModificationTime(),
+		created:  link.CreationTime(),
 		hash:     link.ContentHash(),
+		revision: link.RevisionID(),
 		mimeType: link.MIMEType(),
 	}
 }
@@ -55,6 +60,11 @@ func (self *ProtonNodeInfo) ModTime() time.Time {
 	return self.modTime
 }
 
+// CreationTime is when the file or directory was created in Proton Drive
+func (self *ProtonNodeInfo) CreationTime() time.Time {
+	return self.created
+}
+
 func (self *ProtonNodeInfo) IsDir() bool {
 	return self.isDir
 }
@@ -63,20 +73,41 @@ func (self *ProtonNodeInfo) Sys() any {
 	return nil
 }
 
+// ETag is derived from the active revision of a file, which changes with
+// every upload and stays the same across restarts. Files that are still being
+// uploaded don't have a revision yet and use their content hash instead.
+// Directories use the default ETag of the WebDAV library.
 func (self *ProtonNodeInfo) ETag(_ context.Context) (string, error) {
-	if self.hash == "" {
-		return "", webdav.ErrNotImplemented
+	if self.revision != "" {
+		return fmt.Sprintf(`"%s"`, self.revision), nil
+	}
+
+	if self.hash != "" {
+		return fmt.Sprintf(`"%s"`, self.hash), nil
 	}
 
-	return self.hash, nil
+	return "", webdav.ErrNotImplemented
 }
 
-func (self *ProtonNodeInfo) ContentType(_ context.Context) (string, error) {
-	if self.mimeType == "" {
+// ContentType prefers the type stored in Proton Drive, unless it is a
+// generic one that was stored because the type was unknown at upload. Then
+// the extension decides, or the WebDAV library sniffs the contents if
+// -sniff-content-type allows it.
+func (self *ProtonNodeInfo) ContentType(ctx context.Context) (string, error) {
+	ctype := contentType(self.name, self.mimeType)
+	if ctype != "" {
+		return ctype, nil
+	}
+
+	if sniffAllowed(ctx) {
 		return "", webdav.ErrNotImplemented
 	}
 
-	return self.mimeType, nil
+	if self.mimeType != "" {
+		return self.mimeType, nil
+	}
+
+	return "application/octet-stream", nil
 }
 
 func (self *ProtonNodeInfo) Hashes(_ context.Context) (map[string]string, error) {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	WebhookTimeout = 10 * time.Second
+)
+
+var (
+	OptNotifyURL = ""
+)
+
+// notifiedStates are the states that are reported to -notify-url. The states
+// in between, like connecting, would only add noise.
+var notifiedStates = map[string]bool{
+	StateConnected:     true,
+	StateTokensExpired: true,
+	StateLoggedOut:     true,
+	StateError:         true,
+}
+
+// stateChanged reports the current state of the account to -notify-url, if
+// it differs from the last state that was reported. It never blocks.
+func (self *Account) stateChanged() {
+	self.Status.mu.Lock()
+	state := self.Status.State
+	message := self.Status.Error
+
+	// the error of an earlier attempt is kept in the status
+	if state == StateConnected {
+		message = ""
+	}
+
+	if !notifiedStates[state] || (state == self.Status.notifiedState && message == self.Status.notifiedError) {
+		self.Status.mu.Unlock()
+		return
+	}
+
+	previous := self.Status.notifiedState
+	self.Status.notifiedState = state
+	self.Status.notifiedError = message
+	self.Status.mu.Unlock()
+
+	if OptNotifyURL == "" {
+		return
+	}
+
+	host, _ := os.Hostname()
+
+	go postWebhook(OptNotifyURL, map[string]any{
+		"event":          "state_changed",
+		"host":           host,
+		"account":        self.Name,
+		"state":          state,
+		"previous_state": previous,
+		"error":          message,
+		"time":           time.Now().UTC(),
+	})
+}
+
+// postWebhook sends payload as JSON to url. Failures are only logged, a
+// webhook that is down must not affect the bridge.
+func postWebhook(url string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error encoding webhook payload", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Error creating webhook request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("Error calling webhook", "error", err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		slog.Error("Webhook returned an error", "status", res.Status)
+	}
+}
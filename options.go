@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// envOr returns the value of the environment variable name, or def if it is unset
+func envOr(name, def string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+
+	return def
+}
+
+// envBool returns the boolean value of the environment variable name, or def
+// if it is unset or not a valid boolean
+func envBool(name string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// validateOptions checks the parsed options for consistency
+func validateOptions() error {
+	if OptDownloadFailure != DownloadFailureAbort && OptDownloadFailure != DownloadFailureTruncate {
+		return fmt.Errorf("invalid value for -download-failure: %q", OptDownloadFailure)
+	}
+
+	if OptLockStore != LockStoreMemory && OptLockStore != LockStoreFile {
+		return fmt.Errorf("invalid value for -lock-store: %q", OptLockStore)
+	}
+
+	if OptReadTimeout < 0 || OptWriteTimeout < 0 || OptIdleTimeout < 0 {
+		return fmt.Errorf("-read-timeout, -write-timeout and -idle-timeout must not be negative")
+	}
+
+	if OptMaxConcurrentRequests < 0 {
+		return fmt.Errorf("-max-concurrent-requests must not be negative")
+	}
+
+	if OptMaxUploadSize < 0 {
+		return fmt.Errorf("-max-upload-size must not be negative")
+	}
+
+	if OptDownloadRateLimit < 0 || OptUploadRateLimit < 0 {
+		return fmt.Errorf("-download-rate-limit and -upload-rate-limit must not be negative")
+	}
+
+	if OptContentCacheSize < 0 {
+		return fmt.Errorf("-content-cache-size must not be negative")
+	}
+
+	if len(OptListen) == 0 {
+		return fmt.Errorf("-listen must not be empty")
+	}
+
+	for _, addr := range OptListen {
+		err := validateAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid value for -listen: %w", err)
+		}
+	}
+
+	err := validateAddress(OptAdminListen)
+	if err != nil {
+		return fmt.Errorf("invalid value for -admin-listen: %w", err)
+	}
+
+	if _, ok := cookieSameSiteModes[OptAdminCookieSameSite]; !ok {
+		return fmt.Errorf("invalid value for -admin-cookie-samesite: %q", OptAdminCookieSameSite)
+	}
+
+	if OptAdminCookieSecure != CookieSecureAuto {
+		secure, err := strconv.ParseBool(OptAdminCookieSecure)
+		if err != nil {
+			return fmt.Errorf("invalid value for -admin-cookie-secure: %q", OptAdminCookieSecure)
+		}
+
+		// browsers drop SameSite=None cookies that aren't Secure
+		if !secure && OptAdminCookieSameSite == "none" {
+			return fmt.Errorf("-admin-cookie-samesite none requires -admin-cookie-secure")
+		}
+	}
+
+	if OptBcryptCost < bcrypt.MinCost || OptBcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("-bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	if OptLoginWindow <= 0 {
+		return fmt.Errorf("-admin-login-window must be positive")
+	}
+
+	if OptAdminSessionTTL <= 0 {
+		return fmt.Errorf("-admin-session-ttl must be positive")
+	}
+
+	if OptAdminSessionMaxLifetime < 0 {
+		return fmt.Errorf("-admin-session-max-lifetime must not be negative")
+	}
+
+	if OptTrashEnabled && isRoot(OptTrashDir) {
+		return fmt.Errorf("-trash-dir must not be the root folder")
+	}
+
+	if OptTrashRetention < 0 {
+		return fmt.Errorf("-trash-retention must not be negative")
+	}
+
+	if OptKeepAlive < 0 {
+		return fmt.Errorf("-keep-alive must not be negative")
+	}
+
+	if OptPrewarmDepth < 0 {
+		return fmt.Errorf("-prewarm-depth must not be negative")
+	}
+
+	if OptPrewarm && OptCacheTTL <= 0 {
+		return fmt.Errorf("-prewarm needs the metadata cache, which -cache-ttl 0 disables")
+	}
+
+	if OptUploadReadAhead < 0 {
+		return fmt.Errorf("-upload-read-ahead must not be negative")
+	}
+
+	if OptConnectRetries < -1 {
+		return fmt.Errorf("-connect-retries must be -1 or more")
+	}
+
+	if OptNetworkTimeout < 0 {
+		return fmt.Errorf("-network-timeout must not be negative")
+	}
+
+	if OptConnectRetryMaxDelay <= 0 {
+		return fmt.Errorf("-connect-retry-max-delay must be positive")
+	}
+
+	if OptUploadRetries < 0 {
+		return fmt.Errorf("-upload-retries must not be negative")
+	}
+
+	// The credentials aren't read from their files or commands yet
+	hasUser := OptWebDAVUser != "" || hasCredential("PROTON_WEBDAV_USER")
+	hasPass := OptWebDAVPass != "" || hasCredential("PROTON_WEBDAV_PASS")
+	if hasUser != hasPass {
+		return fmt.Errorf("-webdav-user and -webdav-pass must be set together")
+	}
+
+	if OptHTTP1Only && OptH2C {
+		return fmt.Errorf("-http1-only and -h2c can't be used together")
+	}
+
+	err = validateTLS("tls", OptTLSCert, OptTLSKey)
+	if err != nil {
+		return err
+	}
+
+	err = validateTLS("admin-tls", OptAdminTLSCert, OptAdminTLSKey)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
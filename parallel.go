@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	OptRecursiveWorkers = 4
+
+	// limits the calls of all runParallel invocations together, so
+	// concurrent requests don't multiply the load on the Proton API
+	recursiveSlots     chan struct{}
+	recursiveSlotsOnce sync.Once
+)
+
+// acquireRecursiveSlot blocks until fewer than -recursive-workers calls are
+// running across all requests, or ctx is canceled
+func acquireRecursiveSlot(ctx context.Context) error {
+	recursiveSlotsOnce.Do(func() {
+		recursiveSlots = make(chan struct{}, max(OptRecursiveWorkers, 1))
+	})
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case recursiveSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseRecursiveSlot frees a slot taken by acquireRecursiveSlot
+func releaseRecursiveSlot() {
+	<-recursiveSlots
+}
+
+// runParallel calls fn for every index in [0, n) using at most workers
+// goroutines and returns the error of each call. Calls also wait for a
+// slot shared with all other invocations. Once ctx is canceled, the
+// remaining calls are skipped and report the context error instead.
+func runParallel(ctx context.Context, workers int, n int, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				if err := acquireRecursiveSlot(ctx); err != nil {
+					errs[i] = err
+					continue
+				}
+
+				errs[i] = fn(ctx, i)
+				releaseRecursiveSlot()
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	OptBcryptCost = 12
+)
+
+// hashPassword creates a bcrypt hash of the password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), OptBcryptCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// legacyHashPassword is the salted SHA-256 scheme used by older versions
+func legacyHashPassword(password, salt string) string {
+	hash := sha256.New()
+	hash.Write([]byte(password + salt))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// isLegacyHash reports whether hash was created by legacyHashPassword
+func isLegacyHash(hash string) bool {
+	return !strings.HasPrefix(hash, "$2")
+}
+
+// verifyPassword checks password against a bcrypt or legacy SHA-256 hash.
+// The salt is only used for legacy hashes.
+func verifyPassword(password, hash, salt string) bool {
+	if isLegacyHash(hash) {
+		legacy := legacyHashPassword(password, salt)
+		return subtle.ConstantTimeCompare([]byte(legacy), []byte(hash)) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
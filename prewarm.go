@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+var (
+	OptPrewarm      = false
+	OptPrewarmDepth = 2
+)
+
+// prewarm lists the folders of the drive down to -prewarm-depth in the
+// background, so the metadata cache already holds them when clients start
+// browsing. Folders are listed level by level with -recursive-workers in
+// parallel, and the walk stops when the session is canceled.
+func (self *ProtonFS) prewarm(ctx context.Context, account *Account) {
+	if !OptPrewarm || self.cache == nil {
+		return
+	}
+
+	start := time.Now()
+	listed := 0
+
+	level := []string{"/"}
+	for depth := 1; len(level) > 0; depth++ {
+		var next []string
+		var mu sync.Mutex
+
+		runParallel(ctx, OptRecursiveWorkers, len(level), func(ctx context.Context, i int) error {
+			subdirs := self.prewarmDir(ctx, level[i])
+
+			mu.Lock()
+			next = append(next, subdirs...)
+			mu.Unlock()
+
+			return nil
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		listed += len(level)
+
+		if OptPrewarmDepth > 0 && depth >= OptPrewarmDepth {
+			break
+		}
+
+		level = next
+	}
+
+	account.Log().Info("Prewarmed the metadata cache", "folders", listed, "duration", time.Since(start))
+}
+
+// prewarmDir caches the listing of the folder name and the metadata of its
+// children, and returns the paths of its subfolders
+func (self *ProtonFS) prewarmDir(ctx context.Context, name string) []string {
+	dir, err := self.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil
+	}
+
+	children, err := dir.Readdir(0)
+	dir.Close()
+
+	if err != nil {
+		return nil
+	}
+
+	var subdirs []string
+	for _, child := range children {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		name := path.Join(name, child.Name())
+		self.Stat(ctx, name)
+
+		if child.IsDir() {
+			subdirs = append(subdirs, name)
+		}
+	}
+
+	return subdirs
+}
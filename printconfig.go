@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	OptPrintConfig = false
+)
+
+// secretOptions are never printed by -print-config
+var secretOptions = map[string]bool{
+	"webdav-pass":       true,
+	"admin-setup-token": true,
+}
+
+// urlOptions are webhook URLs, which often carry a token in their path,
+// query or userinfo. Only their scheme and host are printed.
+var urlOptions = map[string]bool{
+	"notify-url":     true,
+	"canary-webhook": true,
+}
+
+// credentialOptions can also be read from a file or a command, see
+// initSecretOptions. -print-config doesn't read them, it only reports that
+// a value will be.
+var credentialOptions = map[string]string{
+	"webdav-user": "PROTON_WEBDAV_USER",
+	"webdav-pass": "PROTON_WEBDAV_PASS",
+}
+
+// redactURL returns the scheme and host of a URL, hiding everything else
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return "<redacted>"
+	}
+
+	redacted := u.Scheme + "://" + u.Host
+	if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		redacted += "/<redacted>"
+	}
+
+	return redacted
+}
+
+// printConfig writes the effective value of every option as JSON. Since the
+// config file and the environment are applied through the flags, these are
+// the values the bridge would run with. Secrets only show whether they are set.
+func printConfig() error {
+	config := map[string]any{}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		switch f.Name {
+		case "print-config", "version":
+			return
+		}
+
+		var value any = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+
+		if duration, ok := value.(time.Duration); ok {
+			value = duration.String()
+		}
+
+		set := f.Value.String() != ""
+		if name, ok := credentialOptions[f.Name]; ok && !set && hasCredential(name) {
+			value = "<from a credential provider>"
+			set = true
+		}
+
+		switch {
+		case !set:
+		case secretOptions[f.Name]:
+			value = "<redacted>"
+		case urlOptions[f.Name]:
+			value = redactURL(f.Value.String())
+		}
+
+		config[f.Name] = value
+	})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(config)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/StollD/webdav"
+)
+
+// creationDateName is DAV:creationdate, which the WebDAV library knows but
+// can't fill in, because os.FileInfo has no creation time
+var creationDateName = xml.Name{Space: "DAV:", Local: "creationdate"}
+
+// creationTimer is implemented by file infos that know when a file was created
+type creationTimer interface {
+	CreationTime() time.Time
+}
+
+// nodeProps returns the properties of a node that the WebDAV library can't
+// find out on its own. They are handed to it as dead properties, so they are
+// included in allprop responses and can be requested by name.
+func nodeProps(info os.FileInfo) map[xml.Name]webdav.Property {
+	props := map[xml.Name]webdav.Property{}
+
+	if info, ok := info.(creationTimer); ok && !info.CreationTime().IsZero() {
+		props[creationDateName] = webdav.Property{
+			XMLName:  creationDateName,
+			InnerXML: []byte(info.CreationTime().UTC().Format(time.RFC3339)),
+		}
+	}
+
+	return props
+}
+
+// forbidPatch rejects all changes to properties, Proton Drive has nowhere
+// to store them
+func forbidPatch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	forbidden := webdav.Propstat{Status: http.StatusForbidden}
+
+	for _, patch := range patches {
+		for _, prop := range patch.Props {
+			forbidden.Props = append(forbidden.Props, webdav.Property{XMLName: prop.XMLName})
+		}
+	}
+
+	return []webdav.Propstat{forbidden}, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	OptTrustedProxies = ""
+	trustedProxies    []*net.IPNet
+)
+
+// initTrustedProxies parses -trusted-proxies, a comma-separated list of IP
+// addresses and CIDR ranges
+func initTrustedProxies() error {
+	trustedProxies = nil
+
+	for _, value := range strings.Split(OptTrustedProxies, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return fmt.Errorf("invalid address in -trusted-proxies: %q", value)
+			}
+
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid range in -trusted-proxies: %q", value)
+		}
+
+		trustedProxies = append(trustedProxies, network)
+	}
+
+	return nil
+}
+
+// isTrustedProxy reports whether the headers sent by addr may be trusted
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the IP address of the peer that sent r
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// clientIP returns the IP address of the client that sent r. Behind trusted
+// proxies, this is the last address in X-Forwarded-For that wasn't added by
+// one of them.
+func clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(addr))
+		}
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if net.ParseIP(forwarded[i]) == nil {
+			break
+		}
+
+		ip = forwarded[i]
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// isHTTPS reports whether the client reached the bridge over HTTPS, either
+// directly or through a trusted proxy that says so in X-Forwarded-Proto
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	if !isTrustedProxy(remoteIP(r)) {
+		return false
+	}
+
+	// the closest proxy appends its value last
+	values := strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(values[len(values)-1]), "https")
+}
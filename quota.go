@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/StollD/webdav"
+)
+
+const (
+	// QuotaPropTimeout limits how long a PROPFIND waits for the quota
+	QuotaPropTimeout = 10 * time.Second
+
+	// MaxQuotaPropfindBody is the largest PROPFIND body that is searched
+	// for the quota properties
+	MaxQuotaPropfindBody = 64 * 1024
+)
+
+// The quota properties of RFC 4331, which file managers use to show the free space
+var (
+	quotaAvailableName = xml.Name{Space: "DAV:", Local: "quota-available-bytes"}
+	quotaUsedName      = xml.Name{Space: "DAV:", Local: "quota-used-bytes"}
+)
+
+// quotaResponse describes how much of the storage of an account is used
+type quotaResponse struct {
+	Account    string    `json:"account,omitempty"`
+	UsedBytes  uint64    `json:"used_bytes"`
+	TotalBytes uint64    `json:"total_bytes"`
+	Error      string    `json:"error,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// fetchQuota asks Proton for the storage usage of an account
+func fetchQuota(ctx context.Context, account *Account) quotaResponse {
+	quota := quotaResponse{Account: account.Name}
+
+	user, updatedAt, err := fetchUser(ctx, account)
+	if err != nil {
+		quota.Error = err.Error()
+		return quota
+	}
+
+	quota.UsedBytes = uint64(user.UsedSpace)
+	quota.TotalBytes = uint64(user.MaxSpace)
+	quota.UpdatedAt = updatedAt
+
+	return quota
+}
+
+func handleQuota(w http.ResponseWriter, r *http.Request) {
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+
+	quota := fetchQuota(r.Context(), account)
+
+	w.Header().Set("Content-Type", "application/json")
+	if quota.Error != "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(quota)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+type quotaTargetKey struct{}
+
+// withQuotaProps finds PROPFIND requests that ask for the quota properties
+// by name, and remembers their target, so only that collection reports the
+// quota. RFC 4331 leaves them out of allprop, and fetching them for every
+// folder of a listing would wait for Proton once per folder.
+func withQuotaProps(prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		name, ok := stripPrefix(r.URL.Path, prefix)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxQuotaPropfindBody+1))
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			return
+		}
+
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+		if len(body) <= MaxQuotaPropfindBody && requestsQuota(body) {
+			r = r.WithContext(context.WithValue(r.Context(), quotaTargetKey{}, name))
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// requestsQuota reports whether a PROPFIND body names a quota property
+func requestsQuota(body []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+
+		if start, ok := token.(xml.StartElement); ok && (start.Name == quotaAvailableName || start.Name == quotaUsedName) {
+			return true
+		}
+	}
+}
+
+// quotaRequested reports whether the PROPFIND of ctx asks for the quota of name
+func quotaRequested(ctx context.Context, name string) bool {
+	target, ok := ctx.Value(quotaTargetKey{}).(string)
+	return ok && target == path.Clean("/"+name)
+}
+
+// quotaProps returns the RFC 4331 quota properties of the drive. The quota is
+// cached with the user, so repeated requests don't ask Proton every time. If
+// it can't be fetched, the properties are left out.
+func (self *ProtonFS) quotaProps(ctx context.Context) map[xml.Name]webdav.Property {
+	ctx, cancel := context.WithTimeout(ctx, QuotaPropTimeout)
+	defer cancel()
+
+	quota := fetchQuota(ctx, self.account)
+	if quota.Error != "" {
+		return nil
+	}
+
+	available := uint64(0)
+	if quota.TotalBytes > quota.UsedBytes {
+		available = quota.TotalBytes - quota.UsedBytes
+	}
+
+	return map[xml.Name]webdav.Property{
+		quotaAvailableName: {
+			XMLName:  quotaAvailableName,
+			InnerXML: []byte(strconv.FormatUint(available, 10)),
+		},
+		quotaUsedName: {
+			XMLName:  quotaUsedName,
+			InnerXML: []byte(strconv.FormatUint(quota.UsedBytes, 10)),
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithQuotaProps(t *testing.T) {
+	const (
+		allprop  = `<?xml version="1.0"?><propfind xmlns="DAV:"><allprop/></propfind>`
+		include  = `<?xml version="1.0"?><propfind xmlns="DAV:"><allprop/><include><quota-used-bytes/></include></propfind>`
+		byName   = `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:quota-available-bytes/></d:prop></d:propfind>`
+		otherNS  = `<?xml version="1.0"?><propfind xmlns="DAV:"><prop><quota-used-bytes xmlns="urn:other"/></prop></propfind>`
+		tooLarge = `<?xml version="1.0"?><propfind xmlns="DAV:"><prop><quota-used-bytes/></prop></propfind>`
+	)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		quota  []string
+	}{
+		{"allprop", "/dav/docs", allprop, nil},
+		{"empty body", "/dav/docs", "", nil},
+		{"by name", "/dav/docs/", byName, []string{"/docs", "docs/"}},
+		{"included in allprop", "/dav", include, []string{"/"}},
+		{"other namespace", "/dav/docs", otherNS, nil},
+		{"large body", "/dav/docs", strings.Repeat(" ", MaxQuotaPropfindBody) + tooLarge, nil},
+		{"outside the prefix", "/other", byName, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body string
+			var quota []string
+
+			handler := withQuotaProps("/dav", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+
+				for _, name := range []string{"/", "/docs", "docs/", "/docs/sub"} {
+					if quotaRequested(r.Context(), name) {
+						quota = append(quota, name)
+					}
+				}
+			}))
+
+			r := httptest.NewRequest("PROPFIND", test.target, strings.NewReader(test.body))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if body != test.body {
+				t.Errorf("handler read a body of %d bytes, want %d", len(body), len(test.body))
+			}
+
+			if strings.Join(quota, ",") != strings.Join(test.quota, ",") {
+				t.Errorf("quota requested for %v, want %v", quota, test.quota)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	OptLoginAttempts = 5
+	OptLoginWindow   = time.Minute
+	loginLimiter     = &LoginLimiter{}
+)
+
+// loginAttempts counts the failed attempts of one client in the current window
+type loginAttempts struct {
+	failures int
+	start    time.Time
+	blocked  bool
+}
+
+// LoginLimiter limits failed admin login attempts per client IP
+type LoginLimiter struct {
+	attempts map[string]*loginAttempts
+	mu       sync.Mutex
+}
+
+// Allow reports whether ip may attempt another login, and if not, how long it
+// has to wait. An allowed attempt is counted as failed right away, so parallel
+// requests can't all pass before the first one is rejected. Reset forgets it
+// once the attempt succeeded.
+func (self *LoginLimiter) Allow(ip string) (bool, time.Duration) {
+	if OptLoginAttempts <= 0 {
+		return true, 0
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.attempts == nil {
+		self.attempts = map[string]*loginAttempts{}
+	}
+
+	entry, ok := self.attempts[ip]
+	if !ok || time.Since(entry.start) >= OptLoginWindow {
+		entry = &loginAttempts{start: time.Now()}
+		self.attempts[ip] = entry
+	}
+
+	if entry.failures < OptLoginAttempts {
+		entry.failures++
+		return true, 0
+	}
+
+	if !entry.blocked {
+		entry.blocked = true
+		slog.Warn("Too many failed admin login attempts, blocking client", "remote", ip, "duration", OptLoginWindow)
+	}
+
+	return false, OptLoginWindow - time.Since(entry.start)
+}
+
+// Reset forgets the failed attempts of ip after a successful attempt
+func (self *LoginLimiter) Reset(ip string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delete(self.attempts, ip)
+}
+
+// prune periodically removes entries whose window has passed
+func (self *LoginLimiter) prune() {
+	for {
+		time.Sleep(OptLoginWindow)
+
+		self.mu.Lock()
+		for ip, entry := range self.attempts {
+			if time.Since(entry.start) >= OptLoginWindow {
+				delete(self.attempts, ip)
+			}
+		}
+		self.mu.Unlock()
+	}
+}
+
+// checkLoginLimit responds with 429 and returns false if the client is rate limited
+func checkLoginLimit(w http.ResponseWriter, r *http.Request) bool {
+	ok, wait := loginLimiter.Allow(clientIP(r))
+	if ok {
+		return true
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+	return false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoginLimitParallel(t *testing.T) {
+	useDataDir(t, t.TempDir())
+
+	savedAuth, savedLimiter, savedAttempts := adminAuth, loginLimiter, OptLoginAttempts
+	t.Cleanup(func() {
+		adminAuth, loginLimiter, OptLoginAttempts = savedAuth, savedLimiter, savedAttempts
+	})
+
+	passwordHash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adminAuth = &AdminAuth{
+		initialized:  true,
+		passwordHash: passwordHash,
+		sessions:     map[string]*adminSession{},
+	}
+	loginLimiter = &LoginLimiter{}
+	OptLoginAttempts = 5
+
+	login := func(password string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"password":"`+password+`"}`))
+		r.RemoteAddr = "192.0.2.1:1234"
+
+		w := httptest.NewRecorder()
+		handleAdminLogin(w, r)
+		return w.Code
+	}
+
+	// a parallel brute force only gets as many guesses as the limit allows
+	var wg sync.WaitGroup
+	codes := make(chan int, 20)
+	start := make(chan struct{})
+
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			codes <- login("wrong password")
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+
+	if counts[http.StatusUnauthorized] != OptLoginAttempts || counts[http.StatusTooManyRequests] != cap(codes)-OptLoginAttempts {
+		t.Errorf("parallel logins: got %v, want %d x 401 and the rest 429", counts, OptLoginAttempts)
+	}
+
+	// a successful login forgets the reserved attempts
+	loginLimiter = &LoginLimiter{}
+	for i := 0; i < OptLoginAttempts-1; i++ {
+		login("wrong password")
+	}
+
+	if code := login("correct horse"); code != http.StatusOK {
+		t.Fatalf("login with the right password: got %d, want %d", code, http.StatusOK)
+	}
+
+	if code := login("wrong password"); code != http.StatusUnauthorized {
+		t.Errorf("login after a successful one: got %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/xml"
+	"io"
 	"io/fs"
 	"os"
 
@@ -10,7 +12,13 @@ import (
 )
 
 var _ webdav.File = &ProtonReadNode{}
+var _ webdav.DeadPropsHolder = &ProtonReadNode{}
+var _ io.Seeker = &ProtonReadNode{}
 
+// ProtonReadNode streams a file from Proton Drive. Seeking is lazy: it only
+// moves the offset, the blocks covering it are downloaded by the next Read.
+// This lets range requests (and HEAD requests, which seek to the end to find
+// the size) avoid downloading anything they don't need.
 type ProtonReadNode struct {
 	ctx     context.Context
 	session *drive.Session
@@ -19,6 +27,12 @@ type ProtonReadNode struct {
 
 	info   os.FileInfo
 	reader *drive.FileReader
+	offset int64
+
+	// the content cache a complete download is stored in
+	cache *ContentCache
+	name  string
+	fill  *contentFill
 }
 
 func NewReadNode(ctx context.Context, session *drive.Session, link *drive.Link) *ProtonReadNode {
@@ -43,10 +57,74 @@ func (self *ProtonReadNode) openReader() error {
 	}
 
 	self.reader = reader
-	return nil
+	return self.seekReader()
+}
+
+// seekReader moves the reader to the current offset. Proton Drive files are
+// stored in blocks, so only the block containing the offset is fetched.
+func (self *ProtonReadNode) seekReader() error {
+	_, err := self.reader.Seek(self.offset, io.SeekStart)
+	return err
+}
+
+// size returns the size of the file contents, which are split into blocks
+func (self *ProtonReadNode) size() int64 {
+	sizes := self.link.BlockSizes()
+	if len(sizes) == 0 {
+		return self.info.Size()
+	}
+
+	var size int64
+	for _, s := range sizes {
+		size += s
+	}
+
+	return size
+}
+
+// fillCache stores data that was read at offset in the content cache. Only
+// a download that starts at the beginning of the file and reads it in order
+// is stored, anything else stops filling the cache.
+func (self *ProtonReadNode) fillCache(offset int64, data []byte, err error) {
+	if self.cache == nil {
+		return
+	}
+
+	if self.fill == nil {
+		if offset != 0 {
+			self.cache = nil
+			return
+		}
+
+		self.fill = self.cache.Fill(self.name, self.link)
+		if self.fill == nil {
+			self.cache = nil
+			return
+		}
+	}
+
+	if (err != nil && err != io.EOF) || !self.fill.Write(offset, data) {
+		self.fill.Abort()
+		self.fill = nil
+		self.cache = nil
+		return
+	}
+
+	// the WebDAV handler stops reading at the end of the file, without
+	// waiting for io.EOF
+	if self.fill.written == self.size() {
+		self.fill.Commit()
+		self.fill = nil
+		self.cache = nil
+	}
 }
 
 func (self *ProtonReadNode) Close() error {
+	if self.fill != nil {
+		self.fill.Abort()
+		self.fill = nil
+	}
+
 	if self.reader == nil {
 		return nil
 	}
@@ -66,16 +144,45 @@ func (self *ProtonReadNode) Read(buffer []byte) (int, error) {
 		return 0, err
 	}
 
-	return self.reader.Read(buffer)
+	offset := self.offset
+
+	n, err := self.reader.Read(buffer)
+	self.offset += int64(n)
+
+	self.fillCache(offset, buffer[:n], err)
+
+	if err != nil && err != io.EOF {
+		reportDownloadFailure(self.ctx, self.link.Name(), err)
+	}
+
+	return n, err
 }
 
 func (self *ProtonReadNode) Seek(offset int64, whence int) (int64, error) {
-	err := self.openReader()
-	if err != nil {
-		return 0, err
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += self.offset
+	case io.SeekEnd:
+		offset += self.size()
+	default:
+		return 0, drive.ErrInvalidSeekOperation
 	}
 
-	return self.reader.Seek(offset, whence)
+	if offset < 0 {
+		return 0, drive.ErrInvalidSeekOperation
+	}
+
+	self.offset = offset
+
+	if self.reader != nil {
+		err := self.seekReader()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return offset, nil
 }
 
 func (self *ProtonReadNode) Readdir(_ int) ([]fs.FileInfo, error) {
@@ -89,3 +196,11 @@ func (self *ProtonReadNode) Stat() (fs.FileInfo, error) {
 func (self *ProtonReadNode) Write(_ []byte) (int, error) {
 	return 0, webdav.ErrNotImplemented
 }
+
+func (self *ProtonReadNode) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return nodeProps(self.info), nil
+}
+
+func (self *ProtonReadNode) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return forbidPatch(patches)
+}
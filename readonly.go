@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+)
+
+var (
+	OptReadOnly = false
+)
+
+// withReadOnly rejects every method that could modify the drive with 405
+// when the bridge runs in read-only mode, before it reaches ProtonFS.
+func withReadOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !OptReadOnly {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if isModifyingMethod(r.Method) {
+			http.Error(w, "The bridge is running in read-only mode", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// isModifyingMethod reports whether a WebDAV method can modify the drive
+func isModifyingMethod(method string) bool {
+	switch method {
+	case "PUT", "DELETE", "MKCOL", "MOVE", "COPY", "PROPPATCH":
+		return true
+	}
+
+	return false
+}
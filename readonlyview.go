@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/StollD/webdav"
+)
+
+var (
+	OptReadOnlySubpath = ""
+)
+
+var _ webdav.FileSystem = readOnlyFS{}
+
+// readOnlyFS wraps a filesystem and refuses every change to it
+type readOnlyFS struct {
+	fs webdav.FileSystem
+}
+
+func (self readOnlyFS) Mkdir(_ context.Context, _ string, _ os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (self readOnlyFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag != os.O_RDONLY {
+		return nil, os.ErrPermission
+	}
+
+	return self.fs.OpenFile(ctx, name, flag, perm)
+}
+
+func (self readOnlyFS) RemoveAll(_ context.Context, _ string) error {
+	return os.ErrPermission
+}
+
+func (self readOnlyFS) Rename(_ context.Context, _, _ string) error {
+	return os.ErrPermission
+}
+
+func (self readOnlyFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return self.fs.Stat(ctx, name)
+}
+
+// isReadOnlyPath reports whether p lies below -listen-webdav-readonly-subpath
+func isReadOnlyPath(p string) bool {
+	if OptReadOnlySubpath == "" {
+		return false
+	}
+
+	_, ok := stripPrefix(p, OptWebDAVPrefix+OptReadOnlySubpath)
+	return ok
+}
+
+// ReadOnlyPrefix returns the URL path the read-only view of the account is
+// served under, if -listen-webdav-readonly-subpath is set
+func (self *Account) ReadOnlyPrefix() string {
+	if self.Name == "" {
+		return OptWebDAVPrefix + OptReadOnlySubpath
+	}
+
+	return OptWebDAVPrefix + OptReadOnlySubpath + "/" + self.Name
+}
+
+// withReadOnlyView serves a read-only view of the filesystem of an account
+// under its read-only prefix, and passes all other requests on to handler.
+// Modifying methods are rejected with 405 before they reach the view. The
+// view has its own locks, which clients take before opening a file, so they
+// can't block writers outside of the view.
+func withReadOnlyView(account *Account, fs webdav.FileSystem, handler http.Handler) http.Handler {
+	if OptReadOnlySubpath == "" {
+		return handler
+	}
+
+	prefix := account.ReadOnlyPrefix()
+
+	var view http.Handler = &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: readOnlyFS{fs: fs},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				account.Log().Debug("WebDAV request failed", "method", r.Method, "path", r.URL.Path, "remote", clientIP(r), "error", err)
+			}
+		},
+	}
+
+	view = withQuotaProps(prefix, view)
+	view = withConditionalGet(fs, prefix, view)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := stripPrefix(r.URL.Path, prefix)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if isModifyingMethod(r.Method) {
+			http.Error(w, "This path is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// locking a missing resource would create it
+		if r.Method == "LOCK" {
+			_, err := fs.Stat(r.Context(), name)
+			if os.IsNotExist(err) {
+				http.Error(w, "This path is read-only", http.StatusMethodNotAllowed)
+				return
+			}
+		}
+
+		view.ServeHTTP(w, r)
+	})
+}
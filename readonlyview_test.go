@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StollD/webdav"
+)
+
+func TestReadOnlyViewLocks(t *testing.T) {
+	saved := OptReadOnlySubpath
+	t.Cleanup(func() { OptReadOnlySubpath = saved })
+
+	OptReadOnlySubpath = "/ro"
+
+	fs := webdav.NewMemFS()
+	writeMemFile(t, fs, "/file.txt", "old")
+
+	handler := withReadOnlyView(newAccount(""), fs, &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	})
+
+	const lockBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+
+	r := httptest.NewRequest("LOCK", "/ro/file.txt", strings.NewReader(lockBody))
+	r.Header.Set("Timeout", "Second-3600")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("LOCK in the read-only view returned %d: %s", w.Code, w.Body)
+	}
+
+	w = serveDAV(handler, http.MethodPut, "/ro/file.txt", nil)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT in the read-only view returned %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	// the lock of the view doesn't block writers outside of it
+	r = httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("new"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated && w.Code != http.StatusNoContent {
+		t.Fatalf("PUT outside of the view returned %d while the view held a lock", w.Code)
+	}
+
+	if content, _ := readMemFile(t, fs, "/file.txt"); content != "new" {
+		t.Errorf("file contains %q, want %q", content, "new")
+	}
+}
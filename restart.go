@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleRestartWebDAV reconnects an account to Proton Drive with its stored
+// tokens, e.g. after the network changed or the connection got stuck. It
+// responds once the account is served again.
+func handleRestartWebDAV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+
+	// without tokens, restarting would only stop the server
+	_, err := loadTokens(account)
+	if err != nil {
+		http.Error(w, "Not logged in", http.StatusConflict)
+		return
+	}
+
+	account.Log().Info("Restarting WebDAV server")
+
+	done := make(chan struct{})
+	go func() {
+		startWebDAVServer(account)
+		close(done)
+	}()
+
+	// if the client gives up, connecting continues in the background
+	select {
+	case <-done:
+	case <-r.Context().Done():
+		return
+	}
+
+	if account.Session() == nil {
+		account.Status.mu.Lock()
+		message := account.Status.Error
+		account.Status.mu.Unlock()
+
+		http.Error(w, "Error connecting to Proton Drive: "+message, http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+var (
+	OptUploadRetries        = 3
+	OptUploadRetryBaseDelay = time.Second
+)
+
+// uploadRetryTransport retries uploads of file blocks to the Proton Drive
+// storage servers when they fail with a transient error. A block is
+// uploaded with a single use token to a fixed URL, so sending it again is
+// safe. Everything else is passed through unchanged.
+type uploadRetryTransport struct {
+	base http.RoundTripper
+}
+
+// initUploadRetries installs the retrying transport. The Proton API client
+// sends its requests through http.DefaultTransport, so this has to happen
+// before any session is created.
+func initUploadRetries() {
+	http.DefaultTransport = &uploadRetryTransport{base: http.DefaultTransport}
+}
+
+func (self *uploadRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	isBlockUpload := req.Method == http.MethodPost && req.Header.Get("pm-storage-token") != ""
+
+	if !isBlockUpload || req.GetBody == nil || OptUploadRetries <= 0 {
+		return self.base.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := self.base.RoundTrip(req)
+
+		if attempt >= OptUploadRetries || !isRetryableUpload(res, err) || req.Context().Err() != nil {
+			return res, err
+		}
+
+		logger := slog.With("attempt", attempt+1, "retries", OptUploadRetries)
+		if err != nil {
+			logger = logger.With("error", err)
+		} else {
+			logger = logger.With("status", res.Status)
+
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		delay := uploadRetryDelay(attempt)
+		logger.Warn("Block upload failed, retrying", "delay", delay)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+}
+
+// isRetryableUpload reports whether a failed upload might succeed if it is
+// tried again. Errors like a rejected token or an exceeded quota are final.
+func isRetryableUpload(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch res.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+
+	return res.StatusCode >= 500
+}
+
+// uploadRetryDelay returns the exponential backoff before the given retry,
+// with jitter so concurrent uploads don't retry in lockstep
+func uploadRetryDelay(attempt int) time.Duration {
+	delay := OptUploadRetryBaseDelay << attempt
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+var (
+	OptRootPath = ""
+)
+
+// abs maps a path of the WebDAV share to the path in the drive. The share is
+// rooted at -root-path, and cleaning the path first keeps it from escaping.
+func (self *ProtonFS) abs(name string) string {
+	if self.root == "" {
+		return name
+	}
+
+	return path.Join(self.root, path.Clean("/"+name))
+}
+
+// checkRootPath makes sure the folder the share is rooted at exists
+func checkRootPath(session *drive.Session) error {
+	if OptRootPath == "" {
+		return nil
+	}
+
+	link := session.Links().LinkFromPath(OptRootPath)
+	if link == nil {
+		return fmt.Errorf("the root path %s does not exist in Proton Drive", OptRootPath)
+	}
+
+	if !link.IsDir() {
+		return fmt.Errorf("the root path %s is not a folder", OptRootPath)
+	}
+
+	return nil
+}
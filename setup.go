@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// setupStateResponse aggregates everything a first-run wizard needs to know
+type setupStateResponse struct {
+	AdminInitialized   bool `json:"admin_initialized"`
+	TokensPresent      bool `json:"tokens_present"`
+	LoggedIn           bool `json:"logged_in"`
+	NeedsLogin         bool `json:"needs_login"`
+	WebDAVRunning      bool `json:"webdav_running"`
+	UsernameEnvSet     bool `json:"username_env_set"`
+	PasswordEnvSet     bool `json:"password_env_set"`
+	AutoLoginAvailable bool `json:"auto_login_available"`
+}
+
+func handleSetupState(w http.ResponseWriter, r *http.Request) {
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	state := setupStateResponse{
+		WebDAVRunning:      webdavRunning.Load(),
+		UsernameEnvSet:     hasCredential(account.EnvName("USERNAME")),
+		PasswordEnvSet:     hasCredential(account.EnvName("PASSWORD")),
+		AutoLoginAvailable: canAutoLogin(account),
+	}
+
+	adminAuth.mu.Lock()
+	state.AdminInitialized = adminAuth.initialized
+	adminAuth.mu.Unlock()
+
+	tokens, err := loadTokens(account)
+	state.TokensPresent = err == nil && tokens.AccessToken != ""
+
+	account.Status.mu.Lock()
+	state.LoggedIn = account.Status.LoggedIn
+	state.NeedsLogin = account.Status.NeedsLogin
+	account.Status.mu.Unlock()
+
+	err = json.NewEncoder(w).Encode(state)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
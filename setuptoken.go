@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+var (
+	OptAdminSetupToken = ""
+)
+
+// initSetupToken creates the one-time token that is needed to set the admin
+// password, so only someone who can read the console of the bridge can
+// claim an uninitialized admin interface. The caller must hold adminAuth.mu.
+// With -no-admin there is nothing to set up, so no token is created.
+func initSetupToken() {
+	if OptNoAdmin {
+		return
+	}
+
+	if OptAdminSetupToken != "" {
+		adminAuth.setupToken = OptAdminSetupToken
+		slog.Info("The admin interface is not set up yet, set the admin password with the token from -admin-setup-token")
+		return
+	}
+
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		slog.Error("Error generating the admin setup token", "error", err)
+		return
+	}
+
+	adminAuth.setupToken = hex.EncodeToString(b)
+
+	// The token is written to stderr directly, so it is printed at any log
+	// level and never ends up in the log buffer, which /api/admin/logs serves
+	fmt.Fprintf(os.Stderr, "The admin interface is not set up yet, set the admin password with this setup token: %s\n", adminAuth.setupToken)
+}
+
+// withSetupAccess lets the first-run wizard read handler before the admin
+// interface is set up, and requires an admin session afterwards
+func withSetupAccess(handler http.HandlerFunc) http.HandlerFunc {
+	authenticated := withAdminAuth(handler)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminAuth.mu.Lock()
+		initialized := adminAuth.initialized
+		adminAuth.mu.Unlock()
+
+		if !initialized {
+			handler(w, r)
+			return
+		}
+
+		authenticated(w, r)
+	}
+}
+
+// checkSetupToken reports whether token is the current setup token
+func checkSetupToken(token string) bool {
+	adminAuth.mu.Lock()
+	defer adminAuth.mu.Unlock()
+
+	if adminAuth.setupToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminAuth.setupToken)) == 1
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestNoSetupTokenWithoutAdmin(t *testing.T) {
+	useDataDir(t, t.TempDir())
+
+	savedAuth, savedNoAdmin := adminAuth, OptNoAdmin
+	t.Cleanup(func() {
+		adminAuth, OptNoAdmin = savedAuth, savedNoAdmin
+	})
+
+	OptNoAdmin = true
+	adminAuth = &AdminAuth{}
+	initAdminAuth()
+
+	if adminAuth.setupToken != "" {
+		t.Error("a setup token was created with -no-admin")
+	}
+
+	OptNoAdmin = false
+	adminAuth = &AdminAuth{}
+	initAdminAuth()
+
+	if adminAuth.setupToken == "" {
+		t.Error("no setup token was created for the uninitialized admin interface")
+	}
+}
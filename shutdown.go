@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	OptShutdownTimeout = 10 * time.Second
+	adminServer        *http.Server
+	adminServerMutex   sync.Mutex
+	tokensMutex        sync.Mutex
+)
+
+// waitForShutdown blocks until SIGINT or SIGTERM is received, then shuts
+// down both servers and exits the process.
+func waitForShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-signals
+	slog.Info("Shutting down", "signal", sig.String())
+
+	done := make(chan struct{})
+	go func() {
+		shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("Shutdown complete")
+		os.Exit(0)
+	case <-signals:
+		slog.Warn("Received second signal, exiting immediately")
+		os.Exit(1)
+	case <-time.After(2 * OptShutdownTimeout):
+		slog.Error("Shutdown timed out, exiting")
+		os.Exit(1)
+	}
+}
+
+// shutdown stops the WebDAV and admin servers and waits for pending token writes
+func shutdown() {
+	// the WebDAV server stops once the last account is disconnected. The
+	// accounts drain their requests in parallel, so the shutdown timeout
+	// applies once and not for each of them.
+	var wg sync.WaitGroup
+	for _, account := range accounts {
+		wg.Add(1)
+		go func(account *Account) {
+			defer wg.Done()
+			stopWebDAVServer(account)
+		}(account)
+	}
+	wg.Wait()
+
+	adminServerMutex.Lock()
+	if adminServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), OptShutdownTimeout)
+		err := adminServer.Shutdown(ctx)
+		cancel()
+
+		if err != nil {
+			slog.Error("Error shutting down admin server", "error", err)
+		}
+	}
+	adminServerMutex.Unlock()
+
+	// wait for a token write that might be in progress, and block new ones
+	tokensMutex.Lock()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// Clients that take longer to send the headers of a request are
+	// disconnected, so they can't tie up connections (slowloris)
+	ReadHeaderTimeout = 10 * time.Second
+)
+
+var (
+	// The read and write timeouts limit the whole request and response.
+	// WebDAV uploads and downloads of large files can take hours, so both
+	// are disabled by default.
+	OptReadTimeout  = time.Duration(0)
+	OptWriteTimeout = time.Duration(0)
+	OptIdleTimeout  = 2 * time.Minute
+)
+
+// newHTTPServer creates a server with the configured timeouts
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       OptReadTimeout,
+		WriteTimeout:      OptWriteTimeout,
+		IdleTimeout:       OptIdleTimeout,
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+var (
+	OptTLSCert      = ""
+	OptTLSKey       = ""
+	OptAdminTLSCert = ""
+	OptAdminTLSKey  = ""
+)
+
+// validateTLS makes sure a certificate and key are either both given or
+// both omitted, and that they can actually be loaded.
+func validateTLS(prefix, cert, key string) error {
+	if cert == "" && key == "" {
+		return nil
+	}
+
+	if cert == "" || key == "" {
+		return fmt.Errorf("-%s-cert and -%s-key must be set together", prefix, prefix)
+	}
+
+	_, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return fmt.Errorf("error loading -%s-cert/-%s-key: %w", prefix, prefix, err)
+	}
+
+	return nil
+}
+
+// serveHTTP runs server, using TLS if a certificate is configured
+func serveHTTP(server *http.Server, cert, key string) error {
+	listener, err := listen(server.Addr)
+	if err != nil {
+		return err
+	}
+
+	return serveListener(server, listener, cert, key)
+}
+
+// serveListener runs server on a listener that is already open. A server
+// can serve several listeners at once, Shutdown closes all of them.
+func serveListener(server *http.Server, listener net.Listener, cert, key string) error {
+	if cert != "" {
+		return server.ServeTLS(listener, cert, key)
+	}
+
+	return server.Serve(listener)
+}
+
+// urlScheme returns the scheme a server with the given certificate is reachable with
+func urlScheme(cert string) string {
+	if cert != "" {
+		return "https"
+	}
+
+	return "http"
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	tokenKey = ""
+)
+
+var (
+	ErrTokensEncrypted = errors.New("the token file is encrypted: set PROTON_TOKEN_KEY to decrypt it")
+	ErrTokensDecrypt   = errors.New("failed to decrypt the token file: is PROTON_TOKEN_KEY correct?")
+)
+
+// encryptedTokens is the on-disk format of an encrypted token file
+type encryptedTokens struct {
+	Version    int    `json:"encrypted"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// initTokenEncryption reads the passphrase the token files are encrypted
+// with, and removes it from the environment so child processes don't see it.
+func initTokenEncryption() error {
+	var err error
+
+	tokenKey, _, err = lookupCredential("PROTON_TOKEN_KEY")
+	os.Unsetenv("PROTON_TOKEN_KEY")
+
+	if err != nil {
+		return err
+	}
+
+	if tokenKey == "" {
+		slog.Warn("PROTON_TOKEN_KEY is not set, tokens are stored unencrypted")
+	}
+
+	return nil
+}
+
+// tokenCipher derives the AES-256 key for the given salt from the passphrase
+func tokenCipher(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(tokenKey), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptTokens seals the serialized tokens, unless no passphrase is set
+func encryptTokens(data []byte) ([]byte, error) {
+	if tokenKey == "" {
+		return data, nil
+	}
+
+	enc := encryptedTokens{
+		Version: 1,
+		Salt:    make([]byte, 16),
+	}
+
+	_, err := rand.Read(enc.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := tokenCipher(enc.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	enc.Nonce = make([]byte, aead.NonceSize())
+
+	_, err = rand.Read(enc.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	enc.Ciphertext = aead.Seal(nil, enc.Nonce, data, nil)
+	return json.Marshal(enc)
+}
+
+// decryptTokens opens an encrypted token file. Plaintext files written
+// without a passphrase are returned unchanged.
+func decryptTokens(data []byte) ([]byte, error) {
+	var enc encryptedTokens
+
+	err := json.Unmarshal(data, &enc)
+	if err != nil || enc.Version == 0 {
+		return data, nil
+	}
+
+	if tokenKey == "" {
+		return nil, ErrTokensEncrypted
+	}
+
+	aead, err := tokenCipher(enc.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(enc.Nonce) != aead.NonceSize() {
+		return nil, ErrTokensDecrypt
+	}
+
+	plain, err := aead.Open(nil, enc.Nonce, enc.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrTokensDecrypt
+	}
+
+	return plain, nil
+}
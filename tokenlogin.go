@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+var (
+	ErrTokensMalformed = errors.New("tokens must be a JSON object with UID, AccessToken, RefreshToken and SaltedKeyPass")
+	ErrTokensRejected  = errors.New("the tokens were rejected by Proton")
+)
+
+// parseTokens decodes tokens that were obtained out-of-band, in the format
+// of the token file
+func parseTokens(data []byte) (drive.Tokens, error) {
+	var tokens drive.Tokens
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&tokens)
+	if err != nil {
+		return tokens, fmt.Errorf("%w: %w", ErrTokensMalformed, err)
+	}
+
+	if tokens.UID == "" || tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.SaltedKeyPass == "" {
+		return tokens, ErrTokensMalformed
+	}
+
+	return tokens, nil
+}
+
+// loginWithTokens validates tokens that were obtained out-of-band by opening
+// a session with them, stores them and starts serving the account. No
+// username or password is needed.
+func loginWithTokens(account *Account, tokens drive.Tokens) error {
+	err := login(account, tokenLogin{tokens: tokens})
+	if err != nil {
+		return err
+	}
+
+	go startWebDAVServer(account)
+	return nil
+}
+
+// tokenLogin logs in with tokens that were obtained out-of-band
+type tokenLogin struct {
+	tokens drive.Tokens
+}
+
+func (self tokenLogin) Name() string {
+	return "tokens"
+}
+
+// Login opens a session to check the tokens, which are refreshed if the
+// access token had expired
+func (self tokenLogin) Login(ctx context.Context, _ *Account, app *drive.Application) (string, error) {
+	tokens := self.tokens
+	app.LoginWithTokens(&tokens)
+
+	err := drive.NewSession(app).Init(ctx)
+	if isAuthRejected(err) {
+		return "", fmt.Errorf("%w: %w", ErrTokensRejected, err)
+	}
+
+	return "", err
+}
+
+// envTokens returns the tokens in the PROTON_TOKENS environment variable of
+// an account, if it is set
+func envTokens(account *Account) (drive.Tokens, bool, error) {
+	value, ok, err := lookupCredential(account.EnvName("TOKENS"))
+	if !ok || err != nil {
+		return drive.Tokens{}, ok, err
+	}
+
+	tokens, err := parseTokens([]byte(value))
+	return tokens, true, err
+}
+
+func handleLoginTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := parseTokens(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = loginWithTokens(account, tokens)
+	if err != nil {
+		account.Log().Warn("Login with tokens failed", "remote", clientIP(r), "error", err)
+	}
+	auditTokenLogin(r, account, err)
+	if errors.Is(err, ErrTokensRejected) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
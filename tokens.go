@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"syscall"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/henrybear327/go-proton-api"
+)
+
+var (
+	OptTokenRefresh = time.Hour
+)
+
+const (
+	// TokenLoadRetries is how often reading the token file at startup is
+	// retried, in case the data directory is on a volume that is still
+	// being mounted
+	TokenLoadRetries    = 5
+	TokenLoadRetryDelay = 2 * time.Second
+
+	// TokenWriteRetryDelay is how long to wait before writing the tokens a
+	// second time, in case space was freed in the meantime
+	TokenWriteRetryDelay = time.Second
+)
+
+// setTokenWarning shows in the status of an account that its tokens could
+// not be saved. The session keeps working with the tokens in memory, but
+// the next restart would need a new login. A successful write clears it.
+func setTokenWarning(account *Account, err error) {
+	warning := ""
+
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		warning = "The data directory is full, so the Proton tokens can't be saved. Free up space, or the next restart will need a new login."
+	case err != nil:
+		warning = "The Proton tokens can't be saved (" + err.Error() + "), the next restart will need a new login."
+	}
+
+	account.Status.mu.Lock()
+	account.Status.TokenWarning = warning
+	account.Status.mu.Unlock()
+}
+
+// isTemporaryReadError reports whether reading a data file failed for a
+// reason other than the file missing or its contents being invalid
+func isTemporaryReadError(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) && !errors.Is(err, fs.ErrNotExist)
+}
+
+// loadTokensWithRetry loads the stored tokens of an account, trying again a
+// few times if the file exists but can't be read
+func loadTokensWithRetry(account *Account) (drive.Tokens, error) {
+	for attempt := 1; ; attempt++ {
+		tokens, err := loadTokens(account)
+		if err == nil || !isTemporaryReadError(err) || attempt > TokenLoadRetries {
+			return tokens, err
+		}
+
+		account.Log().Warn("Error reading tokens, retrying", "error", err, "attempt", attempt, "delay", TokenLoadRetryDelay)
+		time.Sleep(TokenLoadRetryDelay)
+	}
+}
+
+// refreshTokens exchanges the refresh token for a new pair of tokens
+func refreshTokens(ctx context.Context, tokens drive.Tokens) (drive.Tokens, error) {
+	app := drive.NewApplication(AppVersion)
+
+	_, auth, err := app.Manager().NewClientWithRefresh(ctx, tokens.UID, tokens.RefreshToken)
+	if err != nil {
+		return tokens, err
+	}
+
+	return drive.Tokens{
+		UID:           auth.UID,
+		AccessToken:   auth.AccessToken,
+		RefreshToken:  auth.RefreshToken,
+		SaltedKeyPass: tokens.SaltedKeyPass,
+	}, nil
+}
+
+// isAuthRejected reports whether err means Proton rejected our credentials,
+// as opposed to a transient network problem.
+func isAuthRejected(err error) bool {
+	var apiErr *proton.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.Status == 400 || apiErr.Status == 401 || apiErr.Status == 422 ||
+		apiErr.Code == proton.AuthRefreshTokenInvalid
+}
+
+// expireTokens stops serving an account whose tokens were rejected, and
+// renews them with the environment variables if possible. It does nothing
+// if the tokens are already known to be expired.
+func expireTokens(account *Account) {
+	account.Status.mu.Lock()
+	if account.Status.State == StateTokensExpired {
+		account.Status.mu.Unlock()
+		return
+	}
+
+	account.Status.State = StateTokensExpired
+	account.Status.LoggedIn = false
+	account.Status.NeedsLogin = true
+	account.Status.Error = "Tokens expired"
+	account.Status.mu.Unlock()
+	account.stateChanged()
+
+	account.Log().Warn("Tokens expired")
+
+	// Stop serving the account since tokens are expired. This runs
+	// asynchronously, the callback may fire while the session connects.
+	go func() {
+		stopWebDAVServer(account)
+
+		if canAutoLogin(account) {
+			account.Log().Info("Attempting to renew tokens with environment variables")
+			if err := doLogin(account); err != nil {
+				account.Log().Error("Error renewing tokens", "error", err)
+			}
+		} else {
+			account.Log().Info("Please login via the web UI to renew tokens")
+		}
+	}()
+}
+
+// resumeSession validates stored tokens by refreshing them before the
+// WebDAV server is started, so clients never hit an expired session.
+func resumeSession(account *Account, tokens drive.Tokens) {
+	account.Log().Info("Waiting for network")
+
+	err := WaitNetwork(context.Background(), account.Log())
+	if err != nil {
+		account.Log().Error("Error waiting for network", "error", err)
+
+		account.Status.mu.Lock()
+		account.Status.State = StateError
+		account.Status.Error = err.Error()
+		account.Status.mu.Unlock()
+		account.stateChanged()
+		return
+	}
+
+	account.Log().Info("Refreshing stored tokens")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	refreshed, err := refreshTokens(ctx, tokens)
+
+	tokens, ok := resumeTokens(account, tokens, refreshed, err)
+	if !ok {
+		return
+	}
+
+	account.Status.mu.Lock()
+	account.Status.State = StateConnecting
+	account.Status.LoggedIn = true
+	account.Status.LastLogin = time.Now()
+	account.Status.NeedsLogin = false
+	account.Status.mu.Unlock()
+
+	startWebDAVServerWithTokens(account, &tokens)
+}
+
+// resumeTokens picks the tokens a resumed session starts with, given the
+// result of refreshing the stored ones. If Proton rejected them, the account
+// is marked as logged out and false is returned.
+func resumeTokens(account *Account, stored, refreshed drive.Tokens, err error) (drive.Tokens, bool) {
+	if isAuthRejected(err) {
+		account.Log().Warn("Stored tokens are no longer valid", "error", err)
+
+		account.Status.mu.Lock()
+		account.Status.State = StateTokensExpired
+		account.Status.LoggedIn = false
+		account.Status.NeedsLogin = true
+		account.Status.Error = "Stored tokens expired"
+		account.Status.mu.Unlock()
+		account.stateChanged()
+
+		if canAutoLogin(account) {
+			account.Log().Info("Attempting automatic login with environment variables")
+			if err := doLogin(account); err != nil {
+				account.Log().Error("Automatic login failed", "error", err)
+			}
+		} else {
+			account.Log().Info("Please login via the web UI to renew tokens")
+		}
+
+		return drive.Tokens{}, false
+	}
+
+	if err != nil {
+		// the WebDAV server will retry once the API is reachable
+		account.Log().Warn("Error refreshing tokens, continuing with stored tokens", "error", err)
+		return stored, true
+	}
+
+	// the stored tokens were invalidated by the refresh, so the session
+	// has to use the new ones even if they can't be saved
+	err = storeTokens(account, refreshed)
+	if err != nil {
+		account.Log().Error("Error storing tokens", "error", err)
+	}
+
+	return refreshed, true
+}
+
+// keepTokensFresh periodically makes an authenticated request with the
+// session of an account until ctx is canceled. Proton doesn't tell us when
+// the access token expires, but the client transparently refreshes it when
+// a request is rejected. Doing this in the background means the refresh
+// happens here instead of in the middle of a WebDAV request. If the refresh
+// fails, the client reports the tokens as expired, which is handled by the
+// OnTokensExpired callback of the session.
+func keepTokensFresh(ctx context.Context, account *Account, client *proton.Client) {
+	if OptTokenRefresh <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(OptTokenRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := client.GetUser(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			account.Log().Warn("Error refreshing tokens", "error", err)
+			continue
+		}
+
+		account.Log().Debug("Tokens are still valid")
+	}
+}
+
+// refreshTokensResponse is returned by /api/refresh-tokens
+type refreshTokensResponse struct {
+	Success     bool      `json:"success"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// handleRefreshTokens refreshes the stored tokens of an account right away.
+// The stored tokens are only replaced if the refresh worked. Proton
+// invalidates the old refresh token, so a connected account reconnects with
+// the new tokens afterwards.
+func handleRefreshTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account := accountFromRequest(w, r)
+	if account == nil {
+		return
+	}
+
+	tokens, err := loadTokens(account)
+	if err != nil {
+		http.Error(w, "Not logged in", http.StatusConflict)
+		return
+	}
+
+	// The running session holds the refresh token that is about to be
+	// replaced. If it refreshed with it afterwards, the account would be
+	// logged out, so it is stopped first and reconnected afterwards.
+	connected := account.Session() != nil
+
+	account.cancelConnect()
+	account.connecting.Lock()
+	defer account.connecting.Unlock()
+
+	stopWebDAVServer(account)
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	refreshed, err := refreshTokens(ctx, tokens)
+	if err != nil {
+		account.Log().Warn("Error refreshing tokens", "error", err)
+		http.Error(w, "Error refreshing tokens: "+err.Error(), http.StatusBadGateway)
+
+		// the stored tokens are still the current ones
+		if connected {
+			go startWebDAVServer(account)
+		}
+		return
+	}
+
+	// the refreshed tokens are the only valid ones now, even if they
+	// couldn't be stored
+	if connected {
+		go startWebDAVServerWithTokens(account, &refreshed)
+	}
+
+	err = storeTokens(account, refreshed)
+	if err != nil {
+		account.Log().Error("Error storing tokens", "error", err)
+		http.Error(w, "Error storing tokens", http.StatusInternalServerError)
+		return
+	}
+
+	account.Log().Info("Tokens refreshed")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refreshTokensResponse{
+		Success:     true,
+		RefreshedAt: time.Now(),
+	})
+}
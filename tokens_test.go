@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/henrybear327/go-proton-api"
+)
+
+// useDataDir points the data files to dir for the duration of a test
+func useDataDir(t *testing.T, dir string) {
+	t.Helper()
+
+	saved := OptDataDir
+	t.Cleanup(func() { OptDataDir = saved })
+
+	OptDataDir = dir
+}
+
+func TestResumeTokens(t *testing.T) {
+	stored := drive.Tokens{UID: "uid", AccessToken: "old-access", RefreshToken: "old-refresh"}
+	refreshed := drive.Tokens{UID: "uid", AccessToken: "new-access", RefreshToken: "new-refresh"}
+
+	t.Setenv("PROTON_USERNAME", "")
+	t.Setenv("PROTON_PASSWORD", "")
+
+	t.Run("expired by startup", func(t *testing.T) {
+		for _, err := range []error{
+			&proton.APIError{Status: 401},
+			&proton.APIError{Status: 422, Code: proton.AuthRefreshTokenInvalid},
+		} {
+			useDataDir(t, t.TempDir())
+			account := newAccount("")
+
+			_, ok := resumeTokens(account, stored, stored, err)
+			if ok {
+				t.Fatalf("resumed a session after %v", err)
+			}
+
+			if account.Status.State != StateTokensExpired || !account.Status.NeedsLogin || account.Status.LoggedIn {
+				t.Errorf("status after %v: state %q, needs login %v, logged in %v",
+					err, account.Status.State, account.Status.NeedsLogin, account.Status.LoggedIn)
+			}
+
+			if _, err := loadTokens(account); err == nil {
+				t.Error("tokens were stored for a rejected session")
+			}
+		}
+	})
+
+	t.Run("network error", func(t *testing.T) {
+		useDataDir(t, t.TempDir())
+
+		tokens, ok := resumeTokens(newAccount(""), stored, stored, errors.New("connection refused"))
+		if !ok || tokens != stored {
+			t.Fatalf("resumed with %+v (%v), want the stored tokens", tokens, ok)
+		}
+	})
+
+	t.Run("refreshed", func(t *testing.T) {
+		useDataDir(t, t.TempDir())
+		account := newAccount("")
+
+		tokens, ok := resumeTokens(account, stored, refreshed, nil)
+		if !ok || tokens != refreshed {
+			t.Fatalf("resumed with %+v (%v), want the refreshed tokens", tokens, ok)
+		}
+
+		saved, err := loadTokens(account)
+		if err != nil || saved.RefreshToken != refreshed.RefreshToken {
+			t.Fatalf("stored %+v (%v), want the refreshed tokens", saved, err)
+		}
+	})
+
+	t.Run("refreshed but not saved", func(t *testing.T) {
+		// a data directory below a file can't be created
+		blocker := filepath.Join(t.TempDir(), "file")
+		err := os.WriteFile(blocker, nil, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		useDataDir(t, filepath.Join(blocker, "data"))
+		account := newAccount("")
+
+		tokens, ok := resumeTokens(account, stored, refreshed, nil)
+		if !ok || tokens != refreshed {
+			t.Fatalf("resumed with %+v (%v), want the refreshed tokens", tokens, ok)
+		}
+
+		if account.Status.TokenWarning == "" {
+			t.Error("no warning about the unsaved tokens in the status")
+		}
+	})
+}
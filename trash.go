@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+var (
+	OptTrashEnabled   = false
+	OptTrashDir       = ".trash"
+	OptTrashRetention = 30 * 24 * time.Hour
+)
+
+const (
+	TrashSweepInterval = time.Hour
+
+	// colons are avoided because some clients can't handle them in file names
+	TrashTimeFormat = "2006-01-02T15-04-05.000Z"
+)
+
+// trashRoot returns the path of the trash folder in the drive, which is
+// inside -root-path so clients can restore files from it
+func trashRoot() string {
+	return path.Join("/", OptRootPath, OptTrashDir)
+}
+
+// isTrashed reports whether name is the trash folder or inside of it.
+// Deleting such a path removes it for good.
+func isTrashed(name string) bool {
+	return pathHasPrefix(name, trashRoot())
+}
+
+// moveToTrash moves link to a folder in the trash named after the current
+// time, keeping its original path below that folder so it can be restored.
+// share is the path as the client sees it, without -root-path.
+func (self *ProtonFS) moveToTrash(ctx context.Context, link *drive.Link, share string) error {
+	links := self.session.Links()
+	filesystem := self.session.FileSystem()
+
+	dir, file := path.Split(path.Clean("/" + share))
+	target := path.Join(trashRoot(), time.Now().UTC().Format(TrashTimeFormat), dir)
+
+	defer self.invalidate(trashRoot())
+
+	parent, err := self.mkdirAll(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if links.LinkFromPath(path.Join(target, file)) != nil {
+		return os.ErrExist
+	}
+
+	return filesystem.Move(ctx, link, parent, file)
+}
+
+// mkdirAll creates the folder name and all missing parents, and returns it
+func (self *ProtonFS) mkdirAll(ctx context.Context, name string) (*drive.Link, error) {
+	links := self.session.Links()
+	filesystem := self.session.FileSystem()
+
+	link := links.Root()
+	current := "/"
+
+	for _, part := range strings.Split(strings.Trim(path.Clean(name), "/"), "/") {
+		current = path.Join(current, part)
+
+		child := links.LinkFromPath(current)
+		if child == nil {
+			err := filesystem.CreateDir(ctx, link, part)
+			if err != nil && !errors.Is(err, drive.ErrAlreadyExists) {
+				return nil, err
+			}
+
+			child = links.LinkFromPath(current)
+			if child == nil {
+				return nil, os.ErrNotExist
+			}
+		}
+
+		if !child.IsDir() {
+			return nil, os.ErrExist
+		}
+
+		link = child
+	}
+
+	return link, nil
+}
+
+// sweepTrash periodically deletes everything that has been in the trash for
+// longer than the retention period, until ctx is canceled
+func (self *ProtonFS) sweepTrash(ctx context.Context, account *Account) {
+	if !OptTrashEnabled || OptTrashRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(TrashSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		self.purgeTrash(ctx, account)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash deletes the folders in the trash that have expired
+func (self *ProtonFS) purgeTrash(ctx context.Context, account *Account) {
+	links := self.session.Links()
+	filesystem := self.session.FileSystem()
+
+	trash := links.LinkFromPath(trashRoot())
+	if trash == nil || !trash.IsDir() {
+		return
+	}
+
+	cutoff := time.Now().Add(-OptTrashRetention)
+
+	for child := range trash.Children().Iter() {
+		deleted, err := time.Parse(TrashTimeFormat, child.Name())
+		if err != nil || deleted.After(cutoff) {
+			continue
+		}
+
+		err = filesystem.Delete(ctx, child)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			account.Log().Warn("Error purging trash", "folder", child.Name(), "error", err)
+			continue
+		}
+
+		self.invalidate(path.Join(trashRoot(), child.Name()))
+		account.Log().Info("Purged trash", "folder", child.Name())
+	}
+}
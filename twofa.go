@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/henrybear327/go-proton-api"
+)
+
+// Codes in the error_code field of the status, so the admin UI can ask for
+// exactly what is missing
+const (
+	LoginErrorCredentials     = "invalid_credentials"
+	LoginError2FARequired     = "2fa_required"
+	LoginError2FAInvalid      = "2fa_invalid"
+	LoginErrorMailboxPassword = "mailbox_password_required"
+	LoginErrorFailed          = "login_failed"
+)
+
+// loginErrorCode classifies a failed login. Proton answers a wrong password
+// and a wrong 2FA code with the same error, so a rejected login is only
+// blamed on the code if the previous attempt already got past the password
+// and asked for one.
+func loginErrorCode(err error, awaiting2FA bool) string {
+	var apiErr *proton.APIError
+
+	switch {
+	case errors.Is(err, drive.ErrTwoFactorTokenMissing):
+		return LoginError2FARequired
+	case errors.Is(err, drive.ErrMailboxPasswordMissing):
+		return LoginErrorMailboxPassword
+	case errors.Is(err, drive.ErrUsernamePasswordMissing), errors.Is(err, ErrUsernameEmpty), errors.Is(err, ErrPasswordEmpty):
+		return LoginErrorCredentials
+	case errors.As(err, &apiErr) && apiErr.Code == proton.PasswordWrong:
+		if awaiting2FA {
+			return LoginError2FAInvalid
+		}
+
+		return LoginErrorCredentials
+	default:
+		return LoginErrorFailed
+	}
+}
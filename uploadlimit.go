@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+var (
+	OptMaxUploadSize = int64(0)
+)
+
+// maxUploadBytes returns the upload limit in bytes, 0 means unlimited
+func maxUploadBytes() int64 {
+	return OptMaxUploadSize * 1024 * 1024
+}
+
+// withUploadLimit rejects PUT requests larger than -max-upload-size before
+// anything is sent to Proton Drive. Bodies without a Content-Length are
+// counted into a temporary file, so an upload that turns out too large is
+// aborted without leaving a partial file in the drive.
+func withUploadLimit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := maxUploadBytes()
+		if r.Method != http.MethodPut || limit <= 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			rejectUpload(w, r, r.ContentLength)
+			return
+		}
+
+		if r.ContentLength >= 0 {
+			// net/http never reads past the Content-Length
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		spool, err := os.CreateTemp("", "proton-webdav-upload-*")
+		if err != nil {
+			http.Error(w, "Error buffering upload", http.StatusInternalServerError)
+			return
+		}
+
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		size, err := io.Copy(spool, http.MaxBytesReader(w, r.Body, limit))
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			rejectUpload(w, r, -1)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err = spool.Seek(0, io.SeekStart)
+		if err != nil {
+			http.Error(w, "Error buffering upload", http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = spool
+		r.ContentLength = size
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// rejectUpload responds with 413 Payload Too Large
+func rejectUpload(w http.ResponseWriter, r *http.Request, size int64) {
+	slog.Warn("Rejected upload exceeding the size limit", "path", r.URL.Path, "size", size, "limit", maxUploadBytes(), "remote", clientIP(r))
+	http.Error(w, "Upload exceeds the maximum size", http.StatusRequestEntityTooLarge)
+}
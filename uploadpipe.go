@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"sync"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+var (
+	OptUploadReadAhead = 2
+)
+
+// uploadPipe feeds the data of an upload to a FileWriter from a separate
+// goroutine. The drive library uploads one block at a time while it is being
+// written to, so without the pipe reading the request body stalls during
+// every block upload. Up to OptUploadReadAhead blocks are buffered.
+//
+// The block buffers are recycled, so an upload never holds more than
+// OptUploadReadAhead+2 blocks (the ones waiting, the one being uploaded and
+// the one being filled), no matter how large the file is.
+type uploadPipe struct {
+	writer io.Writer
+
+	buffer  []byte
+	blocks  chan []byte
+	free    chan []byte
+	pending sync.WaitGroup
+	done    chan struct{}
+
+	err error
+	mu  sync.Mutex
+}
+
+func newUploadPipe(writer io.Writer) *uploadPipe {
+	pipe := &uploadPipe{
+		writer: writer,
+		blocks: make(chan []byte, OptUploadReadAhead),
+		free:   make(chan []byte, OptUploadReadAhead+2),
+		done:   make(chan struct{}),
+	}
+
+	go pipe.run()
+	return pipe
+}
+
+func (self *uploadPipe) run() {
+	defer close(self.done)
+
+	for block := range self.blocks {
+		// after an error the remaining blocks are only drained
+		if self.Err() == nil {
+			_, err := self.writer.Write(block)
+			if err != nil {
+				self.mu.Lock()
+				self.err = err
+				self.mu.Unlock()
+			}
+		}
+
+		// the FileWriter copies the data, so the buffer can be reused
+		select {
+		case self.free <- block[:0]:
+		default:
+		}
+
+		self.pending.Done()
+	}
+}
+
+// allocate returns an empty block buffer, reusing one that was uploaded
+func (self *uploadPipe) allocate() []byte {
+	select {
+	case buffer := <-self.free:
+		return buffer
+	default:
+		return make([]byte, 0, drive.BlockSize)
+	}
+}
+
+// Err returns the error a previous block failed with
+func (self *uploadPipe) Err() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.err
+}
+
+func (self *uploadPipe) Write(buffer []byte) (int, error) {
+	err := self.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	written := len(buffer)
+
+	for len(buffer) > 0 {
+		if self.buffer == nil {
+			self.buffer = self.allocate()
+		}
+
+		n := min(len(buffer), cap(self.buffer)-len(self.buffer))
+		self.buffer = append(self.buffer, buffer[:n]...)
+		buffer = buffer[n:]
+
+		if len(self.buffer) == cap(self.buffer) {
+			self.send()
+		}
+	}
+
+	return written, nil
+}
+
+func (self *uploadPipe) send() {
+	if len(self.buffer) == 0 {
+		return
+	}
+
+	self.pending.Add(1)
+	self.blocks <- self.buffer
+	self.buffer = nil
+}
+
+// Flush waits until everything written so far has been passed to the
+// FileWriter, so its state can be inspected
+func (self *uploadPipe) Flush() error {
+	self.send()
+	self.pending.Wait()
+
+	return self.Err()
+}
+
+// Close flushes the remaining data and stops the goroutine. The FileWriter
+// itself is not closed.
+func (self *uploadPipe) Close() error {
+	self.send()
+	close(self.blocks)
+	<-self.done
+
+	return self.Err()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"testing"
+
+	drive "github.com/StollD/proton-drive"
+)
+
+// countingWriter stands in for a FileWriter and only checks the data
+type countingWriter struct {
+	written int64
+	blocks  int
+	invalid bool
+}
+
+func (self *countingWriter) Write(buffer []byte) (int, error) {
+	for i, b := range buffer {
+		if b != byte((self.written+int64(i))%251) {
+			self.invalid = true
+			break
+		}
+	}
+
+	self.written += int64(len(buffer))
+	self.blocks++
+	return len(buffer), nil
+}
+
+func TestUploadPipeRecyclesBuffers(t *testing.T) {
+	const blocks = 32
+
+	// a chunk size that doesn't divide the block size, so blocks are
+	// filled from several writes
+	chunk := make([]byte, 48*1024+7)
+	total := int64(blocks * drive.BlockSize)
+
+	writer := &countingWriter{}
+	pipe := newUploadPipe(writer)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	for offset := int64(0); offset < total; {
+		n := min(int64(len(chunk)), total-offset)
+		for i := range chunk[:n] {
+			chunk[i] = byte((offset + int64(i)) % 251)
+		}
+
+		_, err := pipe.Write(chunk[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		offset += n
+	}
+
+	err := pipe.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if writer.written != total || writer.invalid {
+		t.Fatalf("writer got %d bytes (corrupted: %v), want %d", writer.written, writer.invalid, total)
+	}
+
+	if writer.blocks != blocks {
+		t.Errorf("writer got %d blocks, want %d", writer.blocks, blocks)
+	}
+
+	limit := uint64(OptUploadReadAhead+3) * drive.BlockSize
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > limit {
+		t.Errorf("uploading %d MiB allocated %d MiB, want at most %d MiB",
+			total>>20, allocated>>20, limit>>20)
+	}
+}
+
+func TestUploadPipeReportsWriteErrors(t *testing.T) {
+	failure := errors.New("upload failed")
+	pipe := newUploadPipe(writerFunc(func(buffer []byte) (int, error) {
+		return 0, failure
+	}))
+
+	_, err := pipe.Write(bytes.Repeat([]byte{1}, drive.BlockSize))
+	if err != nil {
+		t.Fatalf("first write failed early: %v", err)
+	}
+
+	if err := pipe.Flush(); !errors.Is(err, failure) {
+		t.Fatalf("Flush returned %v, want %v", err, failure)
+	}
+
+	if _, err := pipe.Write([]byte{1}); !errors.Is(err, failure) {
+		t.Fatalf("Write after the failure returned %v, want %v", err, failure)
+	}
+
+	if err := pipe.Close(); !errors.Is(err, failure) {
+		t.Fatalf("Close returned %v, want %v", err, failure)
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (self writerFunc) Write(buffer []byte) (int, error) {
+	return self(buffer)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	drive "github.com/StollD/proton-drive"
+	"github.com/henrybear327/go-proton-api"
+)
+
+const (
+	UserCacheDuration = time.Minute
+
+	// UserErrorCacheDuration is how long a failure is answered from the
+	// cache, so a slow or failing Proton API isn't asked over and over
+	UserErrorCacheDuration = 10 * time.Second
+)
+
+var (
+	users      = map[*Account]cachedUser{}
+	usersMutex sync.Mutex
+)
+
+var (
+	ErrNotLoggedIn = errors.New("not logged in")
+)
+
+// cachedUser is the last answer of Proton about the user of a session
+type cachedUser struct {
+	session   *drive.Session
+	user      proton.User
+	updatedAt time.Time
+	err       error
+}
+
+// fetchUser asks Proton for the user of an account, reusing the last answer
+// if it is recent enough. It returns when the answer was fetched.
+func fetchUser(ctx context.Context, account *Account) (proton.User, time.Time, error) {
+	usersMutex.Lock()
+	defer usersMutex.Unlock()
+
+	session := account.Session()
+	if session == nil {
+		return proton.User{}, time.Time{}, ErrNotLoggedIn
+	}
+
+	// the account might have logged into a different user since
+	cached, ok := users[account]
+	if ok && cached.session == session && cached.err != nil && time.Since(cached.updatedAt) < UserErrorCacheDuration {
+		return proton.User{}, time.Time{}, cached.err
+	}
+	if ok && cached.session == session && cached.err == nil && time.Since(cached.updatedAt) < UserCacheDuration {
+		return cached.user, cached.updatedAt, nil
+	}
+
+	user, err := session.Client().GetUser(ctx)
+	if err != nil {
+		// a canceled request says nothing about Proton
+		if ctx.Err() == nil {
+			users[account] = cachedUser{session: session, updatedAt: time.Now(), err: err}
+		}
+
+		return proton.User{}, time.Time{}, err
+	}
+
+	cached = cachedUser{session: session, user: user, updatedAt: time.Now()}
+	users[account] = cached
+
+	return cached.user, cached.updatedAt, nil
+}
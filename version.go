@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+const (
+	DriveModule = "github.com/StollD/proton-drive"
+)
+
+// Build metadata of the bridge, injected at build time with e.g.
+//
+//	go build -ldflags "-X main.Version=1.0.0 -X main.Commit=$(git rev-parse HEAD) -X main.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Whatever isn't injected is taken from the build info Go embeds, where the
+// time of the commit stands in for the build date.
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+
+	OptVersion = false
+)
+
+// buildInfo describes the build of the running binary
+type buildInfo struct {
+	Version      string
+	Commit       string
+	BuildDate    string
+	DriveVersion string
+	GoVersion    string
+}
+
+// readBuildInfo combines the injected metadata with the build info of the binary
+func readBuildInfo() buildInfo {
+	build := buildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		if build.Version == "" && info.Main.Version != "(devel)" {
+			build.Version = info.Main.Version
+		}
+
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && build.Commit == "":
+				build.Commit = setting.Value
+			case setting.Key == "vcs.time" && build.BuildDate == "":
+				build.BuildDate = setting.Value
+			}
+		}
+
+		for _, dep := range info.Deps {
+			if dep.Path != DriveModule {
+				continue
+			}
+
+			build.DriveVersion = dep.Version
+			if dep.Replace != nil {
+				build.DriveVersion = dep.Replace.Path + " " + dep.Replace.Version
+			}
+		}
+	}
+
+	if build.Version == "" {
+		build.Version = "dev"
+	}
+
+	return build
+}
+
+// printVersion prints the version of the bridge and what it was built from
+func printVersion() {
+	build := readBuildInfo()
+
+	orUnknown := func(value string) string {
+		if value == "" {
+			return "unknown"
+		}
+
+		return value
+	}
+
+	fmt.Println("proton-webdav-bridge", build.Version)
+	fmt.Println("Commit:       ", orUnknown(build.Commit))
+	fmt.Println("Build date:   ", orUnknown(build.BuildDate))
+	fmt.Println("Drive library:", orUnknown(build.DriveVersion))
+	fmt.Println("Go version:   ", build.GoVersion)
+	fmt.Println("App version:  ", AppVersion)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+var (
+	OptWebDAVUser = ""
+	OptWebDAVPass = ""
+	webdavAuth    = &WebDAVAuth{}
+)
+
+// WebDAVAuth holds the credentials clients must present to the WebDAV server
+type WebDAVAuth struct {
+	enabled      bool
+	username     string
+	passwordHash string
+
+	// bcrypt is far too slow to run on every WebDAV request, so the SHA-256
+	// of the last password that passed verification is remembered
+	verified [sha256.Size]byte
+	mu       sync.Mutex
+}
+
+// initWebDAVAuth hashes the configured WebDAV password, so the plaintext
+// doesn't have to be kept around.
+func initWebDAVAuth() error {
+	if OptWebDAVUser == "" && accessTokens.Empty() && OptTLSClientCA == "" {
+		slog.Warn("No WebDAV credentials configured, the WebDAV server is open to anyone who can reach it! " +
+			"Set -webdav-user and -webdav-pass (or PROTON_WEBDAV_USER and PROTON_WEBDAV_PASS).")
+		return nil
+	}
+
+	if OptWebDAVUser == "" {
+		return nil
+	}
+
+	passwordHash, err := hashPassword(OptWebDAVPass)
+	if err != nil {
+		return err
+	}
+
+	webdavAuth.enabled = true
+	webdavAuth.username = OptWebDAVUser
+	webdavAuth.passwordHash = passwordHash
+
+	OptWebDAVPass = ""
+	return nil
+}
+
+// check validates a username and password against the configured credentials
+func (self *WebDAVAuth) check(username, password string) bool {
+	if subtle.ConstantTimeCompare([]byte(username), []byte(self.username)) != 1 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(password))
+
+	self.mu.Lock()
+	cached := subtle.ConstantTimeCompare(sum[:], self.verified[:]) == 1
+	self.mu.Unlock()
+
+	if cached {
+		return true
+	}
+
+	if !verifyPassword(password, self.passwordHash, "") {
+		return false
+	}
+
+	self.mu.Lock()
+	self.verified = sum
+	self.mu.Unlock()
+
+	return true
+}
+
+// withWebDAVAuth enforces HTTP Basic Auth on the WebDAV server. Clients can
+// log in with the configured credentials or with an access token, whose
+// name is the username and whose secret is the password.
+func withWebDAVAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if OptTLSClientCA != "" {
+			serveClientCert(w, r, handler)
+			return
+		}
+
+		if !webdavAuth.enabled && !accessTokens.Required() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if ok && webdavAuth.enabled && webdavAuth.check(username, password) {
+			audit(r, AuditEvent{Event: AuditWebDAVLogin, Success: true, User: username, Method: "password"})
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		permission, valid := "", false
+		if ok {
+			permission, valid = accessTokens.Check(username, password)
+		}
+
+		if !valid {
+			if ok {
+				audit(r, AuditEvent{Event: AuditWebDAVLogin, User: username, Reason: "invalid_credentials"})
+			}
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="Proton Drive", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		audit(r, AuditEvent{Event: AuditWebDAVLogin, Success: true, User: username, Method: "access_token"})
+
+		if permission == PermissionReadOnly {
+			if isModifyingMethod(r.Method) {
+				http.Error(w, "This access token is read-only", http.StatusForbidden)
+				return
+			}
+
+			r = withReadOnlyToken(r)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
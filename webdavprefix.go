@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+var (
+	OptWebDAVPrefix = ""
+)
+
+// withWebDAVPrefix rejects requests outside of the WebDAV prefix, like
+// http.StripPrefix does. The prefix itself is removed by the WebDAV handlers,
+// since it is part of Account.Prefix, so hrefs in responses and Destination
+// headers keep the URLs the clients know.
+func withWebDAVPrefix(handler http.Handler) http.Handler {
+	if OptWebDAVPrefix == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == OptWebDAVPrefix {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = OptWebDAVPrefix + "/"
+			r2.URL.RawPath = ""
+
+			handler.ServeHTTP(w, r2)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, OptWebDAVPrefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+var (
+	OptWindowsCompat = false
+)
+
+// logWindowsCompat notes that the Windows compatibility mode is active, and
+// warns about settings the Windows WebDAV client doesn't work with
+func logWindowsCompat() {
+	if !OptWindowsCompat {
+		return
+	}
+
+	slog.Info("Windows compatibility mode is active")
+
+	authRequired := OptWebDAVUser != "" || accessTokens.Required()
+	if authRequired && OptTLSCert == "" && OptTrustedProxies == "" {
+		slog.Warn("Windows only sends Basic Auth credentials over HTTPS by default. " +
+			"Set -tls-cert and -tls-key, or serve the bridge through an HTTPS reverse proxy.")
+	}
+}
+
+// withWindowsCompat applies the header quirks the WebDAV client of Windows
+// Explorer depends on. It looks for MS-Author-Via on every response, not
+// just on OPTIONS, and probes the root of the server with OPTIONS before
+// it opens a share under a -webdav-prefix.
+func withWindowsCompat(handler http.Handler) http.Handler {
+	if !OptWindowsCompat {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("MS-Author-Via", "DAV")
+
+		outsidePrefix := r.URL.Path != OptWebDAVPrefix && !strings.HasPrefix(r.URL.Path, OptWebDAVPrefix+"/")
+		if r.Method == http.MethodOptions && r.URL.Path != "*" && outsidePrefix {
+			setDAVHeaders(w, "OPTIONS")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -3,8 +3,6 @@ package main
 import (
 	"context"
 	"io/fs"
-	"mime"
-	"path"
 	"time"
 
 	drive "github.com/StollD/proton-drive"
@@ -22,6 +20,10 @@ type ProtonWriteNode struct {
 	name   string
 
 	writer *drive.FileWriter
+	pipe   *uploadPipe
+
+	// called once the file is closed
+	onClose func()
 }
 
 func NewWriteNode(ctx context.Context, session *drive.Session, parent *drive.Link, name string) *ProtonWriteNode {
@@ -46,14 +48,39 @@ func (self *ProtonWriteNode) openWriter() error {
 	}
 
 	self.writer = writer
+
+	if OptUploadReadAhead > 0 {
+		self.pipe = newUploadPipe(writer)
+	}
+
 	return nil
 }
 
+// flush waits for the data that is still buffered in the pipe
+func (self *ProtonWriteNode) flush() error {
+	if self.pipe == nil {
+		return nil
+	}
+
+	return self.pipe.Flush()
+}
+
 func (self *ProtonWriteNode) Close() error {
+	if self.onClose != nil {
+		defer self.onClose()
+	}
+
 	if self.writer == nil {
 		return nil
 	}
 
+	if self.pipe != nil {
+		err := self.pipe.Close()
+		if err != nil {
+			return err
+		}
+	}
+
 	err := self.writer.Close()
 	if err != nil {
 		return err
@@ -81,7 +108,13 @@ func (self *ProtonWriteNode) Stat() (fs.FileInfo, error) {
 		return nil, err
 	}
 
-	mimeType := mime.TypeByExtension(path.Ext(self.name))
+	err = self.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	// the drive library stores unknown types as text/plain
+	mimeType := contentType(self.name, "")
 	if mimeType == "" {
 		mimeType = "text/plain"
 	}
@@ -102,6 +135,10 @@ func (self *ProtonWriteNode) Write(buffer []byte) (int, error) {
 		return 0, err
 	}
 
+	if self.pipe != nil {
+		return self.pipe.Write(buffer)
+	}
+
 	return self.writer.Write(buffer)
 }
 
@@ -111,6 +148,11 @@ func (self *ProtonWriteNode) SetModTime(_ context.Context, modTime time.Time) er
 		return err
 	}
 
+	err = self.flush()
+	if err != nil {
+		return err
+	}
+
 	self.writer.SetModTime(modTime)
 	return nil
 }